@@ -0,0 +1,163 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+type Option func(*Health)
+
+// WithTimeout sets how long /readyz waits for pings of databases.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Health) { o.timeout = timeout }
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *Health) { o.logger = logger }
+}
+
+// Health serves probes of the process: /healthz reports that it's alive,
+// /readyz that all databases are initialized and available and /statsz shows
+// stats of pools.
+type Health struct {
+	librarian *librarian.Librarian
+	timeout   time.Duration
+	logger    *zap.Logger
+
+	ready int32
+}
+
+func New(librarian *librarian.Librarian, opts ...Option) *Health {
+	h := &Health{
+		librarian: librarian,
+		timeout:   2 * time.Second,
+		logger:    zap.NewNop(),
+
+		ready: 0,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// SetReady marks databases as initialized, so they can be pinged.
+func (h *Health) SetReady() {
+	atomic.StoreInt32(&h.ready, 1)
+}
+
+// Ready returns true after SetReady.
+func (h *Health) Ready() bool {
+	return atomic.LoadInt32(&h.ready) == 1
+}
+
+type response struct {
+	Status string `json:"status"`
+	// Statuses of databases by their names
+	Databases map[string]string `json:"databases,omitempty"`
+}
+
+func (h *Health) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, &response{
+		Status:    "ok",
+		Databases: nil,
+	})
+}
+
+type poolStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Ready  int    `json:"ready"`
+}
+
+type statsResponse struct {
+	// Stats of pools by names of their databases
+	Pools map[string]poolStats `json:"pools"`
+}
+
+// StatszHandler shows stats of pools, so their sizes can be tuned.
+func (h *Health) StatszHandler(w http.ResponseWriter, r *http.Request) {
+	res := &statsResponse{
+		Pools: make(map[string]poolStats),
+	}
+	for _, name := range h.librarian.Databases() {
+		pool, ok := h.librarian.Get(name).(*librarian.Pool)
+		if !ok {
+			continue
+		}
+
+		stats := pool.Stats()
+		res.Pools[name] = poolStats{
+			Hits:   stats.Hits,
+			Misses: stats.Misses,
+			Ready:  stats.Ready,
+		}
+	}
+
+	h.writeJSON(w, http.StatusOK, res)
+}
+
+// ReadyzHandler pings databases with the timeout. Errors are logged, but not
+// shown, because probes are usually public.
+func (h *Health) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.Ready() {
+		h.writeJSON(w, http.StatusServiceUnavailable, &response{
+			Status:    "initializing",
+			Databases: nil,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	errs := h.librarian.Ping(ctx)
+
+	res := &response{
+		Status:    "ok",
+		Databases: make(map[string]string),
+	}
+	for _, name := range h.librarian.Databases() {
+		if err, ok := errs[name]; ok {
+			h.logger.Warn("Database is unavailable", zap.String("database", name), zap.Error(err))
+
+			res.Status = "unavailable"
+			res.Databases[name] = "unavailable"
+			continue
+		}
+
+		res.Databases[name] = "ok"
+	}
+
+	status := http.StatusOK
+	if res.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	h.writeJSON(w, status, res)
+}
+
+func (h *Health) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error("Cannot marshal response", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		h.logger.Debug("Cannot write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// authenticate puts the principal of the bearer token to the request context.
+// Requests without a valid token are rejected. If there is no authenticator,
+// all requests are allowed and see all DBs.
+func (a *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.authenticator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := bearerToken(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="librarian"`)
+			a.writeError(w, r, http.StatusUnauthorized, codeUnauthenticated, "Bearer token is required")
+			return
+		}
+
+		principal, err := a.authenticator.Authenticate(r.Context(), token)
+		if err != nil {
+			if errors.Cause(err) == librarian.ErrUnauthenticated {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="librarian", error="invalid_token"`)
+				a.writeError(w, r, http.StatusUnauthorized, codeUnauthenticated, "Bearer token is invalid")
+				return
+			}
+
+			a.logger.Error("Cannot authenticate request", zap.String("requestId", middleware.GetReqID(r.Context())), zap.Error(err))
+			a.writeError(w, r, http.StatusInternalServerError, codeInternalError, "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey, principal)))
+	})
+}
+
+// bearerToken returns the token from the Authorization header or an empty
+// string.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+// principalFrom returns the principal of the request or nil if
+// authentication is disabled.
+func principalFrom(r *http.Request) *librarian.Principal {
+	principal, _ := r.Context().Value(principalKey).(*librarian.Principal)
+
+	return principal
+}
+
+// creatorOptions returns options which make the caller the owner of a new DB.
+func (a *API) creatorOptions(r *http.Request) []librarian.CreaterOption {
+	principal := principalFrom(r)
+	if principal == nil {
+		return nil
+	}
+
+	return []librarian.CreaterOption{librarian.WithOwner(principal.Tenant)}
+}
+
+// create creates a DB within the quota of its owner if quotas are enforced.
+func (a *API) create(ctx context.Context, database librarian.Database, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	if a.enforcer == nil {
+		return database.Create(ctx, opts...)
+	}
+
+	return a.enforcer.Create(ctx, database, opts...)
+}
+
+// clone clones a DB within the quota of its owner if quotas are enforced.
+func (a *API) clone(ctx context.Context, database librarian.Database, id string, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	if a.enforcer == nil {
+		return database.Clone(ctx, id, opts...)
+	}
+
+	return a.enforcer.Clone(ctx, database, id, opts...)
+}
+
+// renew renews a DB within the quota of its owner if quotas are enforced.
+func (a *API) renew(ctx context.Context, database librarian.Database, id string, ttl time.Duration) (*librarian.DB, error) {
+	if a.enforcer == nil {
+		return database.Renew(ctx, id, ttl)
+	}
+
+	return a.enforcer.Renew(ctx, database, id, ttl)
+}
+
+// listerOptions returns options which hide DBs of other tenants from the
+// caller unless it's an admin.
+func listerOptions(r *http.Request) []librarian.ListerOption {
+	principal := principalFrom(r)
+	if principal == nil || principal.Admin {
+		return nil
+	}
+
+	return []librarian.ListerOption{librarian.WithOwnedBy(principal.Tenant)}
+}
+
+// getOwnedDB returns the DB if the caller can access it. Otherwise it writes
+// an error and returns nil. DBs of other tenants are reported as not found,
+// so their names don't leak.
+func (a *API) getOwnedDB(w http.ResponseWriter, r *http.Request, database librarian.Database, id string) *librarian.DB {
+	db, err := database.Get(r.Context(), id)
+	if err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot get DB"), "")
+		return nil
+	}
+
+	if principal := principalFrom(r); principal != nil && !principal.Admin && db.Owner != principal.Tenant {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "DB "+id+" does not exist")
+		return nil
+	}
+
+	return db
+}
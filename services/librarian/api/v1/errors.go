@@ -0,0 +1,209 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// Error codes are stable machine-readable identifiers of problems, unlike
+// titles and details which are for humans.
+const (
+	codeBadRequest       = "bad_request"
+	codeInvalidInput     = "invalid_input"
+	codeNotFound         = "not_found"
+	codeUnauthenticated  = "unauthenticated"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeConflict         = "conflict"
+	codeCapacityExceeded = "capacity_exceeded"
+	codeQuotaExceeded    = "quota_exceeded"
+	codeUnavailable      = "unavailable"
+	codeInternalError    = "internal_error"
+)
+
+type errorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+type errorMeta struct {
+	RequestID string     `json:"requestId,omitempty"`
+	Quota     *quotaMeta `json:"quota,omitempty"`
+}
+
+// quotaMeta is the violated limit of a quota.
+type quotaMeta struct {
+	Limit string `json:"limit"`
+	Max   string `json:"max"`
+}
+
+type errorObject struct {
+	Status string       `json:"status"`
+	Code   string       `json:"code"`
+	Title  string       `json:"title"`
+	Detail string       `json:"detail,omitempty"`
+	Source *errorSource `json:"source,omitempty"`
+	Meta   *errorMeta   `json:"meta,omitempty"`
+}
+
+type errorsResponse struct {
+	Errors []errorObject `json:"errors"`
+}
+
+func newError(status int, code, detail string) errorObject {
+	return errorObject{
+		Status: strconv.Itoa(status),
+		Code:   code,
+		Title:  http.StatusText(status),
+		Detail: detail,
+		Source: nil,
+		Meta:   nil,
+	}
+}
+
+// newPointerError returns an error object pointing to the invalid member of
+// the request document, e.g. "/data/attributes/ttl".
+func newPointerError(status int, code, pointer, detail string) errorObject {
+	e := newError(status, code, detail)
+	e.Source = &errorSource{
+		Pointer: pointer,
+	}
+
+	return e
+}
+
+// newParameterError returns an error object pointing to the invalid query
+// parameter, e.g. "filter[status]".
+func newParameterError(status int, code, parameter, detail string) errorObject {
+	e := newError(status, code, detail)
+	e.Source = &errorSource{
+		Parameter: parameter,
+	}
+
+	return e
+}
+
+func (a *API) writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	a.writeErrors(w, r, status, newError(status, code, detail))
+}
+
+func (a *API) writeErrors(w http.ResponseWriter, r *http.Request, status int, errs ...errorObject) {
+	if requestID := middleware.GetReqID(r.Context()); requestID != "" {
+		for i := range errs {
+			if errs[i].Meta == nil {
+				errs[i].Meta = &errorMeta{
+					RequestID: "",
+					Quota:     nil,
+				}
+			}
+
+			errs[i].Meta.RequestID = requestID
+		}
+	}
+
+	a.writeJSON(w, status, &errorsResponse{
+		Errors: errs,
+	})
+}
+
+// writeLibrarianError maps an error returned by a librarian database to an
+// error object. Unknown errors are logged and hidden from users. Pointer is
+// used only for invalid input and DBs exceeding a quota.
+func (a *API) writeLibrarianError(w http.ResponseWriter, r *http.Request, err error, pointer string) {
+	if qerr, ok := errors.Cause(err).(*librarian.QuotaError); ok {
+		a.writeQuotaError(w, r, qerr, pointer)
+		return
+	}
+
+	switch cause := errors.Cause(err); cause {
+	case librarian.ErrNotFound:
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, errorDetail(err, cause))
+
+	case librarian.ErrConflict:
+		a.writeError(w, r, http.StatusConflict, codeConflict, errorDetail(err, cause))
+
+	case librarian.ErrCapacity:
+		a.logger.Warn("Database is out of capacity", zap.String("requestId", middleware.GetReqID(r.Context())), zap.Error(err))
+		a.writeError(w, r, http.StatusServiceUnavailable, codeCapacityExceeded, errorDetail(err, cause))
+
+	case librarian.ErrUnauthenticated:
+		a.writeError(w, r, http.StatusUnauthorized, codeUnauthenticated, errorDetail(err, cause))
+
+	case librarian.ErrInvalidInput:
+		status := http.StatusUnprocessableEntity
+		if pointer != "" {
+			a.writeErrors(w, r, status, newPointerError(status, codeInvalidInput, pointer, errorDetail(err, cause)))
+		} else {
+			a.writeError(w, r, status, codeInvalidInput, errorDetail(err, cause))
+		}
+
+	default:
+		a.logger.Error("Unhandled librarian error", zap.String("requestId", middleware.GetReqID(r.Context())), zap.Error(err))
+		a.writeError(w, r, http.StatusInternalServerError, codeInternalError, "")
+	}
+}
+
+// writeQuotaError writes 403 if the DB can never fit into the quota, e.g. its
+// TTL is too long, and 429 if it can fit when other DBs of the tenant expire
+// or are deleted. Pointer is used only for 403.
+func (a *API) writeQuotaError(w http.ResponseWriter, r *http.Request, err *librarian.QuotaError, pointer string) {
+	status := http.StatusTooManyRequests
+	detail := "Quota " + err.Limit + " of tenant " + err.Tenant + " is exceeded (max " + err.Max + "), delete DBs or wait until they expire"
+	if err.PerDB {
+		status = http.StatusForbidden
+		detail = "DB exceeds quota " + err.Limit + " of tenant " + err.Tenant + " (max " + err.Max + "), set a shorter TTL"
+	}
+
+	e := newError(status, codeQuotaExceeded, detail)
+	if err.PerDB && pointer != "" {
+		e = newPointerError(status, codeQuotaExceeded, pointer, detail)
+	}
+
+	e.Meta = &errorMeta{
+		RequestID: "",
+		Quota: &quotaMeta{
+			Limit: err.Limit,
+			Max:   err.Max,
+		},
+	}
+
+	a.writeErrors(w, r, status, e)
+}
+
+func (a *API) notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeError(w, r, http.StatusNotFound, codeNotFound, "Resource "+r.URL.Path+" is not found")
+}
+
+func (a *API) methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method "+r.Method+" is not allowed")
+}
+
+// errorDetail returns the message which was attached right to the category
+// error, e.g. "TTL must be positive" for
+// errors.Wrap(librarian.ErrInvalidInput, "TTL must be positive").
+func errorDetail(err, category error) string {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+
+		if c.Cause() == category {
+			return strings.TrimSuffix(err.Error(), ": "+category.Error())
+		}
+
+		err = c.Cause()
+	}
+
+	return ""
+}
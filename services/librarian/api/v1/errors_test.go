@@ -0,0 +1,161 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+func TestWriteLibrarianError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		pointer string
+		status  int
+		want    errorObject
+	}{
+		{
+			name:   "not found",
+			err:    errors.Wrap(errors.Wrap(librarian.ErrNotFound, "DB db_1 does not exist"), "cannot get DB"),
+			status: http.StatusNotFound,
+			want:   newError(http.StatusNotFound, codeNotFound, "DB db_1 does not exist"),
+		},
+		{
+			name:   "conflict",
+			err:    errors.Wrap(librarian.ErrConflict, "DB db_1 already exists"),
+			status: http.StatusConflict,
+			want:   newError(http.StatusConflict, codeConflict, "DB db_1 already exists"),
+		},
+		{
+			name:   "capacity",
+			err:    errors.Wrap(librarian.ErrCapacity, "too many connections"),
+			status: http.StatusServiceUnavailable,
+			want:   newError(http.StatusServiceUnavailable, codeCapacityExceeded, "too many connections"),
+		},
+		{
+			name:   "unauthenticated",
+			err:    errors.Wrap(librarian.ErrUnauthenticated, "token is revoked"),
+			status: http.StatusUnauthorized,
+			want:   newError(http.StatusUnauthorized, codeUnauthenticated, "token is revoked"),
+		},
+		{
+			name:    "invalid input with pointer",
+			err:     errors.Wrap(errors.Wrap(librarian.ErrInvalidInput, "TTL is too long"), "cannot renew DB"),
+			pointer: "/data/attributes/ttl",
+			status:  http.StatusUnprocessableEntity,
+			want:    newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/ttl", "TTL is too long"),
+		},
+		{
+			name:   "invalid input without pointer",
+			err:    librarian.ErrInvalidInput,
+			status: http.StatusUnprocessableEntity,
+			want:   newError(http.StatusUnprocessableEntity, codeInvalidInput, ""),
+		},
+		{
+			name:    "quota per DB",
+			err:     errors.Wrap(&librarian.QuotaError{Tenant: "ci", Limit: librarian.LimitTTL, Max: "1h0m0s", PerDB: true}, "cannot create DB"),
+			pointer: "/data/attributes/ttl",
+			status:  http.StatusForbidden,
+			want: errorObject{
+				Status: "403",
+				Code:   codeQuotaExceeded,
+				Title:  "Forbidden",
+				Detail: "DB exceeds quota maxTTL of tenant ci (max 1h0m0s), set a shorter TTL",
+				Source: &errorSource{Pointer: "/data/attributes/ttl"},
+				Meta:   &errorMeta{Quota: &quotaMeta{Limit: librarian.LimitTTL, Max: "1h0m0s"}},
+			},
+		},
+		{
+			name:    "quota of tenant",
+			err:     &librarian.QuotaError{Tenant: "ci", Limit: librarian.LimitDatabases, Max: "10", PerDB: false},
+			pointer: "/data/attributes/ttl",
+			status:  http.StatusTooManyRequests,
+			want: errorObject{
+				Status: "429",
+				Code:   codeQuotaExceeded,
+				Title:  "Too Many Requests",
+				Detail: "Quota maxDatabases of tenant ci is exceeded (max 10), delete DBs or wait until they expire",
+				Source: nil,
+				Meta:   &errorMeta{Quota: &quotaMeta{Limit: librarian.LimitDatabases, Max: "10"}},
+			},
+		},
+		{
+			name:   "unknown",
+			err:    errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+			want:   newError(http.StatusInternalServerError, codeInternalError, ""),
+		},
+	}
+
+	api := New(librarian.New(), zap.NewNop())
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/databases", nil)
+
+			api.writeLibrarianError(w, r, tt.err, tt.pointer)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			var res errorsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatalf("cannot unmarshal response: %v", err)
+			}
+
+			if len(res.Errors) != 1 {
+				t.Fatalf("got %d errors, want 1", len(res.Errors))
+			}
+			if got := res.Errors[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("error = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorDetail(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		category error
+		want     string
+	}{
+		{
+			name:     "message of the category",
+			err:      errors.Wrap(errors.Wrap(librarian.ErrConflict, "DB db_1 already exists"), "cannot create DB"),
+			category: librarian.ErrConflict,
+			want:     "DB db_1 already exists",
+		},
+		{
+			name:     "bare category",
+			err:      librarian.ErrConflict,
+			category: librarian.ErrConflict,
+			want:     "",
+		},
+		{
+			name:     "another category",
+			err:      errors.Wrap(librarian.ErrNotFound, "DB db_1 does not exist"),
+			category: librarian.ErrConflict,
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorDetail(tt.err, tt.category); got != tt.want {
+				t.Errorf("errorDetail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
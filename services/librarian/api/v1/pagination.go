@@ -0,0 +1,150 @@
+package v1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// sortFields are names of sort fields in the sort parameter.
+// nolint:gochecknoglobals
+var sortFields = map[string]librarian.SortField{
+	"createdAt": librarian.SortCreatedAt,
+	"expiredAt": librarian.SortExpiredAt,
+}
+
+type links struct {
+	Next *string `json:"next"`
+}
+
+// page holds pagination parameters of a listing.
+type page struct {
+	size   int
+	orders []librarian.Order
+	after  *librarian.Cursor
+}
+
+// parsePage parses sort, page[size] and page[after] parameters. Otherwise it
+// writes an error and returns false.
+func (a *API) parsePage(w http.ResponseWriter, r *http.Request) (*page, bool) {
+	query := r.URL.Query()
+
+	p := &page{
+		size:   defaultPageSize,
+		orders: librarian.DefaultSort,
+		after:  nil,
+	}
+
+	if s := query.Get("page[size]"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 1 || size > maxPageSize {
+			a.writeErrors(w, r, http.StatusBadRequest, newParameterError(http.StatusBadRequest, codeBadRequest, "page[size]", "Page size must be from 1 to "+strconv.Itoa(maxPageSize)))
+			return nil, false
+		}
+
+		p.size = size
+	}
+
+	if s := query.Get("sort"); s != "" {
+		p.orders = nil
+
+		for _, name := range strings.Split(s, ",") {
+			desc := strings.HasPrefix(name, "-")
+
+			field, ok := sortFields[strings.TrimPrefix(name, "-")]
+			if !ok {
+				a.writeErrors(w, r, http.StatusBadRequest, newParameterError(http.StatusBadRequest, codeBadRequest, "sort", "Unknown sort field "+name+", must be createdAt or expiredAt"))
+				return nil, false
+			}
+
+			p.orders = append(p.orders, librarian.Order{Field: field, Desc: desc})
+		}
+	}
+
+	if s := query.Get("page[after]"); s != "" {
+		cursor, ok := decodeCursor(s)
+		if !ok {
+			a.writeErrors(w, r, http.StatusBadRequest, newParameterError(http.StatusBadRequest, codeBadRequest, "page[after]", "Cursor is invalid, use links.next of the previous page"))
+			return nil, false
+		}
+
+		p.after = cursor
+	}
+
+	return p, true
+}
+
+// options returns lister options of the page. One more DB is requested to
+// know if there is the next page.
+func (p *page) options() []librarian.ListerOption {
+	opts := []librarian.ListerOption{
+		librarian.WithSort(p.orders...),
+		librarian.WithLimit(p.size + 1),
+	}
+	if p.after != nil {
+		opts = append(opts, librarian.WithAfter(*p.after))
+	}
+
+	return opts
+}
+
+// cut returns DBs of the page and links to the next page if there is one.
+func (p *page) cut(r *http.Request, dbs []librarian.DB) ([]librarian.DB, *links) {
+	if len(dbs) <= p.size {
+		return dbs, &links{Next: nil}
+	}
+
+	dbs = dbs[:p.size]
+
+	query := r.URL.Query()
+	query.Set("page[after]", encodeCursor(librarian.CursorOf(&dbs[len(dbs)-1])))
+	next := r.URL.Path + "?" + query.Encode()
+
+	return dbs, &links{Next: &next}
+}
+
+type cursor struct {
+	Database  string     `json:"d"`
+	CreatedAt time.Time  `json:"c"`
+	ExpiredAt *time.Time `json:"e,omitempty"`
+}
+
+// encodeCursor returns an opaque cursor, clients must not rely on its format.
+func encodeCursor(c librarian.Cursor) string {
+	// NOTE: the cursor has only marshallable fields.
+	b, _ := json.Marshal(&cursor{
+		Database:  c.Database,
+		CreatedAt: c.CreatedAt,
+		ExpiredAt: c.ExpiredAt,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*librarian.Cursor, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Database == "" || c.CreatedAt.IsZero() {
+		return nil, false
+	}
+
+	return &librarian.Cursor{
+		Database:  c.Database,
+		CreatedAt: c.CreatedAt,
+		ExpiredAt: c.ExpiredAt,
+	}, true
+}
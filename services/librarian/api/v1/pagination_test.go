@@ -0,0 +1,107 @@
+package v1
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2019, 6, 1, 12, 0, 0, 123456000, time.UTC)
+	expiredAt := createdAt.Add(time.Hour)
+
+	for _, c := range []librarian.Cursor{
+		{Database: "db_1", CreatedAt: createdAt, ExpiredAt: &expiredAt},
+		{Database: "db_2", CreatedAt: createdAt, ExpiredAt: nil},
+	} {
+		s := encodeCursor(c)
+
+		got, ok := decodeCursor(s)
+		if !ok {
+			t.Fatalf("decodeCursor(%q) failed", s)
+		}
+
+		if got.Database != c.Database || !got.CreatedAt.Equal(c.CreatedAt) {
+			t.Errorf("decodeCursor() = %+v, want %+v", got, c)
+		}
+		if (got.ExpiredAt == nil) != (c.ExpiredAt == nil) || got.ExpiredAt != nil && !got.ExpiredAt.Equal(*c.ExpiredAt) {
+			t.Errorf("decodeCursor() expiredAt = %v, want %v", got.ExpiredAt, c.ExpiredAt)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	valid := encodeCursor(librarian.Cursor{Database: "db_1", CreatedAt: time.Now(), ExpiredAt: nil})
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{name: "not base64", s: "db_1!"},
+		{name: "padded base64", s: valid + "="},
+		{name: "standard base64", s: "+/" + valid},
+		{name: "truncated", s: valid[:len(valid)-3]},
+		{name: "not JSON", s: encode("db_1")},
+		{name: "JSON array", s: encode(`["db_1"]`)},
+		{name: "without database", s: encode(`{"c":"2019-06-01T12:00:00Z"}`)},
+		{name: "without createdAt", s: encode(`{"d":"db_1"}`)},
+		{name: "empty database", s: encode(`{"d":"","c":"2019-06-01T12:00:00Z"}`)},
+		{name: "invalid time", s: encode(`{"d":"db_1","c":"yesterday"}`)},
+		{name: "wrong type", s: encode(`{"d":1,"c":"2019-06-01T12:00:00Z"}`)},
+	}
+
+	for _, tt := range tests {
+		if c, ok := decodeCursor(tt.s); ok {
+			t.Errorf("%s: decodeCursor(%q) = %+v, want invalid", tt.name, tt.s, c)
+		}
+	}
+}
+
+func TestPageCut(t *testing.T) {
+	t0 := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// NOTE: DBs which were created at the same time are ordered by name.
+	dbs := []librarian.DB{
+		{Database: "db_a", CreatedAt: t0},
+		{Database: "db_b", CreatedAt: t0},
+		{Database: "db_c", CreatedAt: t0},
+	}
+
+	r := httptest.NewRequest("GET", "/databases/postgres/dbs?filter[status]=active&page[size]=2", nil)
+	p := &page{size: 2, orders: librarian.DefaultSort, after: nil}
+
+	got, links := p.cut(r, dbs)
+	if len(got) != 2 {
+		t.Fatalf("cut() returned %d DBs, want 2", len(got))
+	}
+	if links.Next == nil {
+		t.Fatal("next link is nil")
+	}
+
+	next, err := url.Parse(*links.Next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := next.Query().Get("filter[status]"); status != "active" {
+		t.Errorf("filter[status] of next link = %q, want active", status)
+	}
+
+	after, ok := decodeCursor(next.Query().Get("page[after]"))
+	if !ok {
+		t.Fatalf("cursor of next link %s is invalid", *links.Next)
+	}
+	if want := librarian.CursorOf(&dbs[1]); !reflect.DeepEqual(*after, want) {
+		t.Errorf("cursor of next link = %+v, want %+v", *after, want)
+	}
+
+	// The last page has no next link
+	if _, links := p.cut(r, dbs[:2]); links.Next != nil {
+		t.Errorf("next link of the last page = %s, want nil", *links.Next)
+	}
+}
@@ -0,0 +1,288 @@
+package v1
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// defaultCredentialsTTL is TTL of credentials if it isn't set by users.
+const defaultCredentialsTTL = time.Hour
+
+type userAttributes struct {
+	Username  string  `json:"username"`
+	Password  *string `json:"password,omitempty"`
+	Role      string  `json:"role"`
+	ExpiredAt *string `json:"expiredAt"`
+}
+
+type userResource struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Attributes userAttributes `json:"attributes"`
+}
+
+type userResponse struct {
+	Data userResource `json:"data"`
+}
+
+type usersResponse struct {
+	Data []userResource `json:"data"`
+}
+
+// newUserResource converts User to JSON:API resource of the given type.
+// Password is only shown right after creation.
+func newUserResource(typ string, user *librarian.User, withPassword bool) userResource {
+	var password *string
+	if withPassword {
+		password = &user.Password
+	}
+
+	return userResource{
+		Type: typ,
+		ID:   user.Username,
+		Attributes: userAttributes{
+			Username:  user.Username,
+			Password:  password,
+			Role:      string(user.Role),
+			ExpiredAt: formatTime(user.ExpiredAt),
+		},
+	}
+}
+
+// parseRole converts the role attribute to an option.
+func parseRole(role string) (librarian.UserOption, *errorObject) {
+	switch role := librarian.Role(role); role {
+	case librarian.RoleOwner, librarian.RoleReadWrite, librarian.RoleReadOnly:
+		return librarian.WithRole(role), nil
+	default:
+		e := newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/role", "Role must be owner, readwrite or readonly")
+		return nil, &e
+	}
+}
+
+func (a *API) userListHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	db := a.getOwnedDB(w, r, database, id)
+	if db == nil {
+		return
+	}
+
+	result := usersResponse{
+		Data: make([]userResource, 0, len(db.Users)),
+	}
+	for i := range db.Users {
+		result.Data = append(result.Data, newUserResource("users", &db.Users[i], false))
+	}
+
+	a.writeJSON(w, http.StatusOK, &result)
+}
+
+func (a *API) userCreateHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	type requestAttributes struct {
+		Username *string `json:"username"`
+		Password *string `json:"password"`
+		// Set empty for readwrite
+		Role *string `json:"role"`
+	}
+
+	type requestData struct {
+		Type       string            `json:"type"`
+		Attributes requestAttributes `json:"attributes"`
+	}
+
+	type request struct {
+		Data requestData `json:"data"`
+	}
+
+	// NOTE: body is optional, all attributes will be generated.
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.writeError(w, r, http.StatusBadRequest, codeBadRequest, "Request body is not a valid JSON")
+		return
+	}
+
+	if req.Data.Type != "" && req.Data.Type != "users" {
+		a.writeErrors(w, r, http.StatusConflict, newPointerError(http.StatusConflict, codeConflict, "/data/type", "Type must be users"))
+		return
+	}
+
+	var (
+		opts []librarian.UserOption
+		errs []errorObject
+	)
+
+	attrs := req.Data.Attributes
+	if attrs.Username != nil {
+		if !identifierRe.MatchString(*attrs.Username) {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/username", identifierDetail))
+		} else {
+			opts = append(opts, librarian.WithUserUsername(*attrs.Username))
+		}
+	}
+	if attrs.Password != nil {
+		if *attrs.Password == "" || len(*attrs.Password) > maxPasswordLength {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/password", "Password must be from 1 to 128 characters"))
+		} else {
+			opts = append(opts, librarian.WithUserPassword(*attrs.Password))
+		}
+	}
+	if attrs.Role != nil {
+		if opt, e := parseRole(*attrs.Role); e != nil {
+			errs = append(errs, *e)
+		} else {
+			opts = append(opts, opt)
+		}
+	}
+
+	if len(errs) > 0 {
+		a.writeErrors(w, r, http.StatusUnprocessableEntity, errs...)
+		return
+	}
+
+	if a.getOwnedDB(w, r, database, id) == nil {
+		return
+	}
+
+	res, err := database.CreateUser(r.Context(), id, opts...)
+	if err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot create user"), "")
+		return
+	}
+
+	a.writeJSON(w, http.StatusCreated, &userResponse{
+		Data: newUserResource("users", res, true),
+	})
+}
+
+func (a *API) userDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+	username := chi.URLParam(r, "username")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	if a.getOwnedDB(w, r, database, id) == nil {
+		return
+	}
+
+	if err := database.DeleteUser(r.Context(), id, username); err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot delete user"), "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// credentialsCreateHandler issues short-lived credentials: a new user with
+// generated username and password which is deleted after TTL.
+func (a *API) credentialsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	type requestAttributes struct {
+		// Set empty for 1h
+		TTL *string `json:"ttl"`
+		// Set empty for readwrite
+		Role *string `json:"role"`
+	}
+
+	type requestData struct {
+		Type       string            `json:"type"`
+		Attributes requestAttributes `json:"attributes"`
+	}
+
+	type request struct {
+		Data requestData `json:"data"`
+	}
+
+	// NOTE: body is optional, all attributes will be generated.
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.writeError(w, r, http.StatusBadRequest, codeBadRequest, "Request body is not a valid JSON")
+		return
+	}
+
+	if req.Data.Type != "" && req.Data.Type != "credentials" {
+		a.writeErrors(w, r, http.StatusConflict, newPointerError(http.StatusConflict, codeConflict, "/data/type", "Type must be credentials"))
+		return
+	}
+
+	var (
+		opts []librarian.UserOption
+		errs []errorObject
+	)
+
+	ttl := defaultCredentialsTTL
+
+	attrs := req.Data.Attributes
+	if attrs.TTL != nil {
+		v, err := time.ParseDuration(*attrs.TTL)
+		if err != nil || v <= 0 {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/ttl", "TTL must be a positive duration, e.g. 30m"))
+		} else {
+			ttl = v
+		}
+	}
+	if attrs.Role != nil {
+		if opt, e := parseRole(*attrs.Role); e != nil {
+			errs = append(errs, *e)
+		} else {
+			opts = append(opts, opt)
+		}
+	}
+
+	if len(errs) > 0 {
+		a.writeErrors(w, r, http.StatusUnprocessableEntity, errs...)
+		return
+	}
+
+	opts = append(opts, librarian.WithUserTTL(ttl))
+
+	if a.getOwnedDB(w, r, database, id) == nil {
+		return
+	}
+
+	res, err := database.CreateUser(r.Context(), id, opts...)
+	if err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot create credentials"), "")
+		return
+	}
+
+	a.writeJSON(w, http.StatusCreated, &userResponse{
+		Data: newUserResource("credentials", res, true),
+	})
+}
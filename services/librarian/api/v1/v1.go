@@ -2,9 +2,15 @@ package v1
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/shardhub/shards/services/librarian"
@@ -14,27 +20,90 @@ const (
 	RFC3339Milli = "2006-01-02T15:04:05.999Z07:00"
 )
 
+const (
+	maxPasswordLength = 128
+	identifierDetail  = "Must be from 1 to 63 characters: letters, digits, _ and -"
+)
+
+// identifierRe matches database names and usernames which are accepted from
+// users. They are also used as IDs in URLs.
+var identifierRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,63}$`) // nolint:gochecknoglobals
+
+type Option func(*API)
+
+// WithAuthenticator requires bearer tokens and restricts tenants to their own
+// DBs. Without it, the API is open and everybody sees all DBs.
+func WithAuthenticator(authenticator librarian.Authenticator) Option {
+	return func(o *API) { o.authenticator = authenticator }
+}
+
+// WithEnforcer limits DBs of tenants by quotas of the enforcer. It requires
+// an authenticator, anonymous callers aren't limited.
+func WithEnforcer(enforcer *librarian.Enforcer) Option {
+	return func(o *API) { o.enforcer = enforcer }
+}
+
+// WithReadiness rejects requests with 503 until ready returns true, e.g.
+// while databases are initialized.
+func WithReadiness(ready func() bool) Option {
+	return func(o *API) { o.ready = ready }
+}
+
 type API struct {
-	librarian *librarian.Librarian
+	librarian     *librarian.Librarian
+	authenticator librarian.Authenticator
+	enforcer      *librarian.Enforcer
+	ready         func() bool
 
 	mux    *chi.Mux
 	logger *zap.Logger
 }
 
-func New(librarian *librarian.Librarian, logger *zap.Logger) *API {
+func New(librarian *librarian.Librarian, logger *zap.Logger, opts ...Option) *API {
 	api := &API{
-		librarian: librarian,
+		librarian:     librarian,
+		authenticator: nil,
+		enforcer:      nil,
+		ready:         nil,
 
 		mux:    chi.NewMux(),
 		logger: logger,
 	}
 
+	for _, opt := range opts {
+		opt(api)
+	}
+
+	api.mux.Use(middleware.RequestID)
+	api.mux.Use(requestIDHeader)
+	api.mux.Use(api.checkReadiness)
+	api.mux.Use(api.authenticate)
+
+	api.mux.NotFound(api.notFoundHandler)
+	api.mux.MethodNotAllowed(api.methodNotAllowedHandler)
+
 	api.mux.Route("/databases", func(r chi.Router) {
 		r.Get("/", api.databasesListHandler)
 
 		r.Route("/{name:[A-Za-z0-9-_]+}", func(r chi.Router) {
 			r.Route("/dbs", func(r chi.Router) {
+				r.Get("/", api.dbListHandler)
 				r.Post("/", api.dbCreateHandler)
+				r.Delete("/", api.dbBulkDeleteHandler)
+
+				r.Route("/{id:[A-Za-z0-9-_]+}", func(r chi.Router) {
+					r.Get("/", api.dbGetHandler)
+					r.Patch("/", api.dbRenewHandler)
+					r.Delete("/", api.dbDeleteHandler)
+					r.Post("/clones", api.dbCloneHandler)
+
+					r.Route("/users", func(r chi.Router) {
+						r.Get("/", api.userListHandler)
+						r.Post("/", api.userCreateHandler)
+						r.Delete("/{username:[A-Za-z0-9-_]+}", api.userDeleteHandler)
+					})
+					r.Post("/credentials", api.credentialsCreateHandler)
+				})
 			})
 		})
 	})
@@ -46,6 +115,31 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.mux.ServeHTTP(w, r)
 }
 
+// requestIDHeader returns the request ID to users, so they can refer to it.
+func requestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestID := middleware.GetReqID(r.Context()); requestID != "" {
+			w.Header().Set("X-Request-Id", requestID)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkReadiness rejects requests until the API is ready. Authentication
+// needs databases too, so it goes first.
+func (a *API) checkReadiness(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.ready != nil && !a.ready() {
+			w.Header().Set("Retry-After", "1")
+			a.writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "Databases are not initialized yet")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (a *API) databasesListHandler(w http.ResponseWriter, r *http.Request) {
 	databases := a.librarian.Databases()
 
@@ -68,19 +162,59 @@ func (a *API) databasesListHandler(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	b, err := json.Marshal(&result)
+	a.writeJSON(w, http.StatusOK, &result)
+}
+
+func (a *API) dbListHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	opts := listerOptions(r)
+
+	if status := r.URL.Query().Get("filter[status]"); status != "" {
+		switch librarian.Status(status) {
+		case librarian.StatusActive, librarian.StatusExpired, librarian.StatusDeleted:
+			opts = append(opts, librarian.WithStatus(librarian.Status(status)))
+		default:
+			a.writeErrors(w, r, http.StatusBadRequest, newParameterError(http.StatusBadRequest, codeBadRequest, "filter[status]", "Unknown status "+status))
+			return
+		}
+	}
+
+	selector, ok := a.selector(w, r)
+	if !ok {
+		return
+	}
+	opts = append(opts, librarian.WithSelector(selector))
+
+	page, ok := a.parsePage(w, r)
+	if !ok {
+		return
+	}
+	opts = append(opts, page.options()...)
+
+	dbs, err := database.List(r.Context(), opts...)
 	if err != nil {
-		// TODO
-		a.logger.Error("Cannot marshal response", zap.Error(err))
-		http.Error(w, "", http.StatusInternalServerError)
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot list DBs"), "")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/vnd.api+json")
-	if _, err := w.Write(b); err != nil {
-		// TODO
-		a.logger.Error("Cannot write response", zap.Error(err))
+	dbs, links := page.cut(r, dbs)
+
+	result := dbsResponse{
+		Data:  make([]dbResource, 0, len(dbs)),
+		Links: links,
+	}
+	for i := range dbs {
+		result.Data = append(result.Data, newDBResource(&dbs[i], false))
 	}
+
+	a.writeJSON(w, http.StatusOK, &result)
 }
 
 func (a *API) dbCreateHandler(w http.ResponseWriter, r *http.Request) {
@@ -88,69 +222,473 @@ func (a *API) dbCreateHandler(w http.ResponseWriter, r *http.Request) {
 
 	database := a.librarian.Get(name)
 	if database == nil {
-		// TODO
-		http.Error(w, "", http.StatusNotFound)
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
 		return
 	}
 
-	// TODO
-	res, err := database.Create(r.Context())
+	type requestMigration struct {
+		Name string `json:"name"`
+		SQL  string `json:"sql"`
+	}
+
+	type requestAttributes struct {
+		dbCreateAttributes
+		Template *string `json:"template"`
+		// Migrations are applied to the DB in order
+		Migrations []requestMigration `json:"migrations"`
+	}
+
+	type requestData struct {
+		Type       string            `json:"type"`
+		Attributes requestAttributes `json:"attributes"`
+	}
+
+	type request struct {
+		Data requestData `json:"data"`
+	}
+
+	// NOTE: body is optional, all attributes will be generated.
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.writeError(w, r, http.StatusBadRequest, codeBadRequest, "Request body is not a valid JSON")
+		return
+	}
+
+	if req.Data.Type != "" && req.Data.Type != "dbs" {
+		a.writeErrors(w, r, http.StatusConflict, newPointerError(http.StatusConflict, codeConflict, "/data/type", "Type must be dbs"))
+		return
+	}
+
+	attrs := req.Data.Attributes
+	opts, errs := attrs.options()
+
+	if attrs.Template != nil {
+		if *attrs.Template == "" {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/template", "Template must not be empty"))
+		} else {
+			opts = append(opts, librarian.WithTemplate(*attrs.Template))
+		}
+	}
+	if len(attrs.Migrations) > 0 {
+		migrations := make([]librarian.Migration, 0, len(attrs.Migrations))
+		for i, m := range attrs.Migrations {
+			pointer := "/data/attributes/migrations/" + strconv.Itoa(i)
+
+			if m.Name == "" {
+				errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, pointer+"/name", "Migration name must not be empty"))
+			}
+			if m.SQL == "" {
+				errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, pointer+"/sql", "Migration SQL must not be empty"))
+			}
+
+			migrations = append(migrations, librarian.Migration{
+				Name: m.Name,
+				SQL:  m.SQL,
+			})
+		}
+
+		opts = append(opts, librarian.WithMigrations(migrations...))
+	}
+
+	if len(errs) > 0 {
+		a.writeErrors(w, r, http.StatusUnprocessableEntity, errs...)
+		return
+	}
+
+	opts = append(opts, a.creatorOptions(r)...)
+
+	res, err := a.create(r.Context(), database, opts...)
 	if err != nil {
-		// TODO
-		a.logger.Error("Cannot create DB", zap.Error(err))
-		http.Error(w, "", http.StatusInternalServerError)
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot create DB"), "")
 		return
 	}
 
-	type responseAttributes struct {
-		Database  string  `json:"database"`
-		Username  string  `json:"username"`
-		Password  string  `json:"password"`
-		ExpiredAt *string `json:"expiredAt"`
+	a.writeJSON(w, http.StatusCreated, &dbResponse{
+		Data: newDBResource(res, true),
+	})
+}
+
+func (a *API) dbCloneHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
 	}
 
-	type responseData struct {
+	type requestData struct {
 		Type       string             `json:"type"`
-		ID         string             `json:"id"`
-		Attributes responseAttributes `json:"attributes"`
+		Attributes dbCreateAttributes `json:"attributes"`
 	}
 
-	type response struct {
-		Data responseData `json:"data"`
+	type request struct {
+		Data requestData `json:"data"`
+	}
+
+	// NOTE: body is optional, all attributes will be generated.
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.writeError(w, r, http.StatusBadRequest, codeBadRequest, "Request body is not a valid JSON")
+		return
 	}
 
-	var expiredAt *string
-	if res.ExpiredAt != nil {
-		v := res.ExpiredAt.Format(RFC3339Milli)
+	if req.Data.Type != "" && req.Data.Type != "dbs" {
+		a.writeErrors(w, r, http.StatusConflict, newPointerError(http.StatusConflict, codeConflict, "/data/type", "Type must be dbs"))
+		return
+	}
 
-		expiredAt = &v
+	opts, errs := req.Data.Attributes.options()
+	if len(errs) > 0 {
+		a.writeErrors(w, r, http.StatusUnprocessableEntity, errs...)
+		return
 	}
 
-	result := response{
-		Data: responseData{
-			Type: "dbs",
-			ID:   res.Database + "_" + res.Username,
-			Attributes: responseAttributes{
-				Database:  res.Database,
-				Username:  res.Username,
-				Password:  res.Password,
-				ExpiredAt: expiredAt,
-			},
-		},
+	if a.getOwnedDB(w, r, database, id) == nil {
+		return
 	}
 
-	b, err := json.Marshal(&result)
+	opts = append(opts, a.creatorOptions(r)...)
+
+	res, err := a.clone(r.Context(), database, id, opts...)
+	if err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot clone DB"), "")
+		return
+	}
+
+	a.writeJSON(w, http.StatusCreated, &dbResponse{
+		Data: newDBResource(res, true),
+	})
+}
+
+func (a *API) dbGetHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	res := a.getOwnedDB(w, r, database, id)
+	if res == nil {
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, &dbResponse{
+		Data: newDBResource(res, false),
+	})
+}
+
+func (a *API) dbRenewHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	type requestAttributes struct {
+		TTL string `json:"ttl"`
+	}
+
+	type requestData struct {
+		Type       string            `json:"type"`
+		ID         string            `json:"id"`
+		Attributes requestAttributes `json:"attributes"`
+	}
+
+	type request struct {
+		Data requestData `json:"data"`
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.writeError(w, r, http.StatusBadRequest, codeBadRequest, "Request body is not a valid JSON")
+		return
+	}
+
+	if req.Data.Type != "dbs" {
+		a.writeErrors(w, r, http.StatusConflict, newPointerError(http.StatusConflict, codeConflict, "/data/type", "Type must be dbs"))
+		return
+	}
+	if req.Data.ID != id {
+		a.writeErrors(w, r, http.StatusConflict, newPointerError(http.StatusConflict, codeConflict, "/data/id", "ID must match the URL"))
+		return
+	}
+
+	ttl, err := time.ParseDuration(req.Data.Attributes.TTL)
+	if err != nil || ttl <= 0 {
+		a.writeErrors(w, r, http.StatusUnprocessableEntity, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/ttl", "TTL must be a positive duration, e.g. 30m"))
+		return
+	}
+
+	if a.getOwnedDB(w, r, database, id) == nil {
+		return
+	}
+
+	res, err := a.renew(r.Context(), database, id, ttl)
+	if err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot renew DB"), "/data/attributes/ttl")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, &dbResponse{
+		Data: newDBResource(res, false),
+	})
+}
+
+func (a *API) dbDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	id := chi.URLParam(r, "id")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	if a.getOwnedDB(w, r, database, id) == nil {
+		return
+	}
+
+	if err := database.Delete(r.Context(), id); err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot delete DB"), "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dbBulkDeleteHandler deletes DBs of the caller whose labels match
+// filter[labels], e.g. all DBs of a pipeline. The selector is required, so
+// all DBs can't be deleted by mistake. Deleted DBs are returned.
+func (a *API) dbBulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	database := a.librarian.Get(name)
+	if database == nil {
+		a.writeError(w, r, http.StatusNotFound, codeNotFound, "Database "+name+" is not found")
+		return
+	}
+
+	selector, ok := a.selector(w, r)
+	if !ok {
+		return
+	}
+	if len(selector) == 0 {
+		a.writeErrors(w, r, http.StatusBadRequest, newParameterError(http.StatusBadRequest, codeBadRequest, "filter[labels]", "Selector is required, e.g. pipeline=42"))
+		return
+	}
+
+	opts := listerOptions(r)
+	opts = append(opts, librarian.WithSelector(selector))
+
+	dbs, err := database.List(r.Context(), opts...)
+	if err != nil {
+		a.writeLibrarianError(w, r, errors.Wrap(err, "cannot list DBs"), "")
+		return
+	}
+
+	result := dbsResponse{
+		Data:  make([]dbResource, 0, len(dbs)),
+		Links: nil,
+	}
+	for i := range dbs {
+		if dbs[i].DeletedAt != nil {
+			continue
+		}
+
+		// NOTE: DBs which were deleted concurrently, e.g. by the reaper, are
+		// skipped.
+		if err := database.Delete(r.Context(), dbs[i].Database); err != nil {
+			if errors.Cause(err) == librarian.ErrNotFound {
+				continue
+			}
+
+			a.writeLibrarianError(w, r, errors.Wrapf(err, "cannot delete DB %s", dbs[i].Database), "")
+			return
+		}
+
+		result.Data = append(result.Data, newDBResource(&dbs[i], false))
+	}
+
+	a.writeJSON(w, http.StatusOK, &result)
+}
+
+// selector parses filter[labels]. Otherwise it writes an error and returns
+// false.
+func (a *API) selector(w http.ResponseWriter, r *http.Request) (librarian.Selector, bool) {
+	selector, err := librarian.ParseSelector(r.URL.Query().Get("filter[labels]"))
+	if err != nil {
+		a.writeErrors(w, r, http.StatusBadRequest, newParameterError(http.StatusBadRequest, codeBadRequest, "filter[labels]", errorDetail(err, librarian.ErrInvalidInput)))
+		return nil, false
+	}
+
+	return selector, true
+}
+
+func (a *API) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		// TODO
 		a.logger.Error("Cannot marshal response", zap.Error(err))
-		http.Error(w, "", http.StatusInternalServerError)
+
+		// NOTE: we can't marshal anything here, so the body is prepared.
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, err := w.Write([]byte(`{"errors":[{"status":"500","code":"` + codeInternalError + `","title":"Internal Server Error"}]}`)); err != nil {
+			a.logger.Error("Cannot write response", zap.Error(err))
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/vnd.api+json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	if _, err := w.Write(b); err != nil {
-		// TODO
 		a.logger.Error("Cannot write response", zap.Error(err))
 	}
 }
+
+// dbCreateAttributes are attributes of a new DB which are accepted on create
+// and clone.
+type dbCreateAttributes struct {
+	TTL      *string `json:"ttl"`
+	Database *string `json:"database"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	// Labels are metadata which DBs can be selected by, e.g. repo=shards
+	Labels map[string]string `json:"labels"`
+}
+
+// options validates attributes and converts them to creater options.
+func (attrs *dbCreateAttributes) options() ([]librarian.CreaterOption, []errorObject) {
+	var (
+		opts []librarian.CreaterOption
+		errs []errorObject
+	)
+
+	if attrs.TTL != nil {
+		ttl, err := time.ParseDuration(*attrs.TTL)
+		if err != nil || ttl <= 0 {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/ttl", "TTL must be a positive duration, e.g. 30m"))
+		} else {
+			opts = append(opts, librarian.WithTTL(ttl))
+		}
+	}
+	if attrs.Database != nil {
+		if !identifierRe.MatchString(*attrs.Database) {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/database", identifierDetail))
+		} else {
+			opts = append(opts, librarian.WithDatabase(*attrs.Database))
+		}
+	}
+	if attrs.Username != nil {
+		if !identifierRe.MatchString(*attrs.Username) {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/username", identifierDetail))
+		} else {
+			opts = append(opts, librarian.WithUsername(*attrs.Username))
+		}
+	}
+	if attrs.Password != nil {
+		if *attrs.Password == "" || len(*attrs.Password) > maxPasswordLength {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/password", "Password must be from 1 to 128 characters"))
+		} else {
+			opts = append(opts, librarian.WithPassword(*attrs.Password))
+		}
+	}
+	if attrs.Labels != nil {
+		if err := librarian.ValidateLabels(attrs.Labels); err != nil {
+			errs = append(errs, newPointerError(http.StatusUnprocessableEntity, codeInvalidInput, "/data/attributes/labels", errorDetail(err, librarian.ErrInvalidInput)))
+		} else {
+			opts = append(opts, librarian.WithLabels(attrs.Labels))
+		}
+	}
+
+	return opts, errs
+}
+
+type dbUser struct {
+	Username  string  `json:"username"`
+	Role      string  `json:"role"`
+	ExpiredAt *string `json:"expiredAt"`
+}
+
+type dbAttributes struct {
+	Database  string            `json:"database"`
+	Username  string            `json:"username"`
+	Password  *string           `json:"password,omitempty"`
+	Users     []dbUser          `json:"users"`
+	Labels    map[string]string `json:"labels"`
+	Status    string            `json:"status"`
+	CreatedAt string            `json:"createdAt"`
+	ExpiredAt *string           `json:"expiredAt"`
+	DeletedAt *string           `json:"deletedAt"`
+}
+
+type dbResource struct {
+	Type       string       `json:"type"`
+	ID         string       `json:"id"`
+	Attributes dbAttributes `json:"attributes"`
+}
+
+type dbResponse struct {
+	Data dbResource `json:"data"`
+}
+
+type dbsResponse struct {
+	Data  []dbResource `json:"data"`
+	Links *links       `json:"links,omitempty"`
+}
+
+// newDBResource converts DB to JSON:API resource. Password is only shown
+// right after creation.
+func newDBResource(db *librarian.DB, withPassword bool) dbResource {
+	var password *string
+	if withPassword {
+		password = &db.Password
+	}
+
+	users := make([]dbUser, 0, len(db.Users))
+	for _, u := range db.Users {
+		users = append(users, dbUser{
+			Username:  u.Username,
+			Role:      string(u.Role),
+			ExpiredAt: formatTime(u.ExpiredAt),
+		})
+	}
+
+	labels := db.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return dbResource{
+		Type: "dbs",
+		ID:   db.Database,
+		Attributes: dbAttributes{
+			Database:  db.Database,
+			Username:  db.Username,
+			Password:  password,
+			Users:     users,
+			Labels:    labels,
+			Status:    string(db.Status(time.Now())),
+			CreatedAt: db.CreatedAt.Format(RFC3339Milli),
+			ExpiredAt: formatTime(db.ExpiredAt),
+			DeletedAt: formatTime(db.DeletedAt),
+		},
+	}
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+
+	v := t.Format(RFC3339Milli)
+
+	return &v
+}
@@ -0,0 +1,38 @@
+package librarian
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Principal is an authenticated caller of the API.
+type Principal struct {
+	// Tenant owns DBs which are created by the principal
+	Tenant string
+	// Admin can see and manage DBs of all tenants
+	Admin bool
+}
+
+// Authenticator returns the principal of a bearer token. It returns
+// ErrUnauthenticated if the token is unknown or revoked.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Authenticators tries authenticators in order and returns the principal of
+// the first one which accepts the token.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	for _, authenticator := range a {
+		principal, err := authenticator.Authenticate(ctx, token)
+		if errors.Cause(err) == ErrUnauthenticated {
+			continue
+		}
+
+		return principal, err
+	}
+
+	return nil, errors.Wrap(ErrUnauthenticated, "token is not accepted")
+}
@@ -0,0 +1,343 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+
+	// Hashes of supported algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var nowFunc = time.Now // nolint:gochecknoglobals
+
+// maxNumericDate is 9999-12-31T23:59:59Z, later dates are rejected.
+const maxNumericDate = 253402300799
+
+// TenantPrefix is prepended to tenants of JWTs, so a subject of the IdP can't
+// take over DBs of a tenant of API tokens with the same name.
+const TenantPrefix = "jwt:"
+
+var _ librarian.Authenticator = (*Verifier)(nil)
+
+type Option func(*Verifier)
+
+// WithIssuer requires the iss claim to be equal to the issuer. It's required.
+func WithIssuer(issuer string) Option {
+	return func(o *Verifier) { o.issuer = issuer }
+}
+
+// WithAudience requires the aud claim to contain the audience. It's required.
+func WithAudience(audience string) Option {
+	return func(o *Verifier) { o.audience = audience }
+}
+
+// WithTenantClaim sets the claim which is used as the tenant, sub by default.
+func WithTenantClaim(claim string) Option {
+	return func(o *Verifier) { o.tenantClaim = claim }
+}
+
+// WithGroupsClaim sets the claim with groups of the subject, groups by
+// default. It can be a string or an array of strings.
+func WithGroupsClaim(claim string) Option {
+	return func(o *Verifier) { o.groupsClaim = claim }
+}
+
+// WithAdminGroups makes members of any of the groups admins.
+func WithAdminGroups(groups ...string) Option {
+	return func(o *Verifier) { o.adminGroups = groups }
+}
+
+// WithLeeway allows clock skew between the librarian and the issuer when exp
+// and nbf are checked.
+func WithLeeway(leeway time.Duration) Option {
+	return func(o *Verifier) { o.leeway = leeway }
+}
+
+// Verifier authenticates JWTs which are signed with one of the keys. Only
+// asymmetric algorithms are accepted: RS256, RS384, RS512, ES256, ES384 and
+// ES512. Tokens must have the exp, iss and aud claims. All tokens are
+// rejected unless the issuer and the audience are set, because tokens of
+// other issuers or for other services could be accepted otherwise.
+type Verifier struct {
+	keys []Key
+
+	issuer      string
+	audience    string
+	tenantClaim string
+	groupsClaim string
+	adminGroups []string
+	leeway      time.Duration
+}
+
+func New(keys []Key, opts ...Option) *Verifier {
+	v := &Verifier{
+		keys: keys,
+
+		issuer:      "",
+		audience:    "",
+		tenantClaim: "sub",
+		groupsClaim: "groups",
+		adminGroups: nil,
+		leeway:      0,
+	}
+
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type algorithm struct {
+	hash crypto.Hash
+	// Key size of ECDSA in bytes, 0 for RSA
+	ecdsaSize int
+}
+
+// nolint:gochecknoglobals
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, ecdsaSize: 32},
+	"ES384": {hash: crypto.SHA384, ecdsaSize: 48},
+	"ES512": {hash: crypto.SHA512, ecdsaSize: 66},
+}
+
+// Authenticate verifies the signature and claims of the token and returns its
+// principal. Any invalid token is reported as librarian.ErrUnauthenticated.
+func (v *Verifier) Authenticate(ctx context.Context, token string) (*librarian.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(librarian.ErrUnauthenticated, "token is not a JWT")
+	}
+
+	var h header
+	if err := decodePart(parts[0], &h); err != nil {
+		return nil, errors.Wrap(librarian.ErrUnauthenticated, "cannot decode header")
+	}
+
+	alg, ok := algorithms[h.Alg]
+	if !ok {
+		return nil, errors.Wrapf(librarian.ErrUnauthenticated, "algorithm %q is not supported", h.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(librarian.ErrUnauthenticated, "cannot decode signature")
+	}
+
+	if !v.verify(h, alg, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errors.Wrap(librarian.ErrUnauthenticated, "signature is invalid")
+	}
+
+	var c claims
+	if err := decodePart(parts[1], &c); err != nil {
+		return nil, errors.Wrap(librarian.ErrUnauthenticated, "cannot decode claims")
+	}
+
+	if err := v.validate(c); err != nil {
+		return nil, err
+	}
+
+	return v.principal(c)
+}
+
+// verify checks the signature with keys of the header's kid. Keys without ID
+// are tried if there are no keys with the kid.
+func (v *Verifier) verify(h header, alg algorithm, signed, signature []byte) bool {
+	hasher := alg.hash.New()
+	hasher.Write(signed) // nolint:errcheck
+	digest := hasher.Sum(nil)
+
+	candidates := make([]Key, 0, len(v.keys))
+	for _, key := range v.keys {
+		if key.ID == h.Kid {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, key := range v.keys {
+			if key.ID == "" {
+				candidates = append(candidates, key)
+			}
+		}
+	}
+
+	for _, key := range candidates {
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			if alg.ecdsaSize != 0 {
+				continue
+			}
+
+			if rsa.VerifyPKCS1v15(pub, alg.hash, digest, signature) == nil {
+				return true
+			}
+
+		case *ecdsa.PublicKey:
+			if alg.ecdsaSize == 0 || (pub.Curve.Params().BitSize+7)/8 != alg.ecdsaSize {
+				continue
+			}
+			if len(signature) != 2*alg.ecdsaSize {
+				continue
+			}
+
+			r := new(big.Int).SetBytes(signature[:alg.ecdsaSize])
+			s := new(big.Int).SetBytes(signature[alg.ecdsaSize:])
+			if ecdsa.Verify(pub, digest, r, s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type claims map[string]interface{}
+
+// validate checks registered claims. It returns librarian.ErrUnauthenticated
+// if any of them is invalid.
+func (v *Verifier) validate(c claims) error {
+	if v.issuer == "" || v.audience == "" {
+		return errors.Wrap(librarian.ErrUnauthenticated, "issuer and audience of verifier aren't set")
+	}
+
+	now := nowFunc()
+
+	exp, err := c.time("exp")
+	if err != nil {
+		return err
+	}
+	if exp == nil {
+		return errors.Wrap(librarian.ErrUnauthenticated, "exp claim is required")
+	}
+	if !now.Before(exp.Add(v.leeway)) {
+		return errors.Wrap(librarian.ErrUnauthenticated, "token is expired")
+	}
+
+	nbf, err := c.time("nbf")
+	if err != nil {
+		return err
+	}
+	if nbf != nil && now.Add(v.leeway).Before(*nbf) {
+		return errors.Wrap(librarian.ErrUnauthenticated, "token is not valid yet")
+	}
+
+	if iss, _ := c["iss"].(string); iss != v.issuer {
+		return errors.Wrapf(librarian.ErrUnauthenticated, "issuer %q is not accepted", iss)
+	}
+
+	if !contains(c.strings("aud"), v.audience) {
+		return errors.Wrap(librarian.ErrUnauthenticated, "audience is not accepted")
+	}
+
+	return nil
+}
+
+// principal maps claims to the principal: the tenant claim with TenantPrefix
+// to the tenant and admin groups to the admin role.
+func (v *Verifier) principal(c claims) (*librarian.Principal, error) {
+	tenant, _ := c[v.tenantClaim].(string)
+	if tenant == "" {
+		return nil, errors.Wrapf(librarian.ErrUnauthenticated, "%s claim is required", v.tenantClaim)
+	}
+
+	admin := false
+	for _, group := range c.strings(v.groupsClaim) {
+		if contains(v.adminGroups, group) {
+			admin = true
+			break
+		}
+	}
+
+	return &librarian.Principal{
+		Tenant: TenantPrefix + tenant,
+		Admin:  admin,
+	}, nil
+}
+
+// time returns a NumericDate claim or nil if there is no such claim. It
+// returns librarian.ErrUnauthenticated if the claim isn't a number of seconds
+// from 1970 to 9999.
+func (c claims) time(name string) (*time.Time, error) {
+	value, ok := c[name]
+	if !ok {
+		return nil, nil
+	}
+
+	n, ok := value.(json.Number)
+	if !ok {
+		return nil, errors.Wrapf(librarian.ErrUnauthenticated, "%s claim must be a number", name)
+	}
+
+	f, err := n.Float64()
+	if err != nil || math.IsNaN(f) || f < 0 || f > maxNumericDate {
+		return nil, errors.Wrapf(librarian.ErrUnauthenticated, "%s claim is out of range", name)
+	}
+
+	sec := math.Floor(f)
+	t := time.Unix(int64(sec), int64((f-sec)*1e9))
+
+	return &t, nil
+}
+
+// strings returns a claim which can be a string or an array of strings.
+func (c claims) strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+func decodePart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	return d.Decode(v)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,380 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "librarian"
+)
+
+// testKeys are keys which sign tokens in tests.
+type testKeys struct {
+	rsa      *rsa.PrivateKey
+	ec       *ecdsa.PrivateKey
+	otherRSA *rsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKeys{
+		rsa:      rsaKey,
+		ec:       ecKey,
+		otherRSA: otherRSAKey,
+	}
+}
+
+// encodeToken encodes the header and claims and signs them with the key:
+// *rsa.PrivateKey and *ecdsa.PrivateKey sign with the hash of the alg header,
+// []byte with HMAC-SHA256 and nil makes an empty signature.
+func encodeToken(t *testing.T, header, claims string, key interface{}) string {
+	t.Helper()
+
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	json.Unmarshal([]byte(header), &h) // nolint:errcheck,gosec
+
+	signed := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	hash := crypto.SHA256
+	if alg, ok := algorithms[h.Alg]; ok {
+		hash = alg.hash
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signed)) // nolint:errcheck
+	digest := hasher.Sum(nil)
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(signature[size-len(rb):size], rb)
+		copy(signature[2*size-len(sb):], sb)
+
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed)) // nolint:errcheck
+		signature = mac.Sum(nil)
+
+	case nil:
+	default:
+		t.Fatalf("unknown key %T", key)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// claimsJSON returns valid claims with overrides, nil values delete claims.
+func claimsJSON(t *testing.T, now time.Time, overrides map[string]interface{}) string {
+	t.Helper()
+
+	c := map[string]interface{}{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "alice",
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+
+		c[k] = v
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestVerifierAuthenticate(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	defer func(f func() time.Time) { nowFunc = f }(nowFunc)
+	nowFunc = func() time.Time { return now }
+
+	keys := newTestKeys(t)
+
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&keys.rsa.PublicKey)})
+
+	verifier := New(
+		[]Key{
+			{ID: "rsa", Public: &keys.rsa.PublicKey},
+			{ID: "ec", Public: &keys.ec.PublicKey},
+		},
+		WithIssuer(testIssuer),
+		WithAudience(testAudience),
+		WithAdminGroups("admins"),
+		WithLeeway(time.Minute),
+	)
+
+	rs256 := `{"alg":"RS256","kid":"rsa"}`
+	valid := claimsJSON(t, now, nil)
+
+	tests := []struct {
+		name  string
+		token string
+		want  *librarian.Principal
+	}{
+		{
+			name:  "RS256",
+			token: encodeToken(t, rs256, valid, keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "RS512",
+			token: encodeToken(t, `{"alg":"RS512","kid":"rsa"}`, valid, keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "ES256",
+			token: encodeToken(t, `{"alg":"ES256","kid":"ec"}`, valid, keys.ec),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "admin group",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"groups": []string{"devs", "admins"}}), keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: true},
+		},
+		{
+			name:  "audience in array",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"aud": []string{"other", testAudience}}), keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "expired within leeway",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "not before within leeway",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"nbf": now.Add(30 * time.Second).Unix()}), keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "expires after 2262",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": int64(10413792000)}), keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+		{
+			name:  "fractional exp",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": float64(now.Unix()) + 3600.5}), keys.rsa),
+			want:  &librarian.Principal{Tenant: "jwt:alice", Admin: false},
+		},
+
+		// Algorithms
+		{
+			name:  "alg none",
+			token: encodeToken(t, `{"alg":"none","kid":"rsa"}`, valid, nil),
+		},
+		{
+			name:  "HS256 with RSA public key as secret",
+			token: encodeToken(t, `{"alg":"HS256","kid":"rsa"}`, valid, rsaPEM),
+		},
+		{
+			name:  "ES256 header with RSA signature",
+			token: encodeToken(t, `{"alg":"ES256","kid":"rsa"}`, valid, keys.rsa),
+		},
+		{
+			name:  "RS256 header with ECDSA signature",
+			token: encodeToken(t, `{"alg":"RS256","kid":"ec"}`, valid, keys.ec),
+		},
+		{
+			name:  "RS512 header with RS256 signature",
+			token: replaceHeader(encodeToken(t, rs256, valid, keys.rsa), `{"alg":"RS512","kid":"rsa"}`),
+		},
+
+		// Keys
+		{
+			name:  "wrong key",
+			token: encodeToken(t, rs256, valid, keys.otherRSA),
+		},
+		{
+			name:  "kid of another key",
+			token: encodeToken(t, `{"alg":"RS256","kid":"ec"}`, valid, keys.rsa),
+		},
+		{
+			name:  "unknown kid",
+			token: encodeToken(t, `{"alg":"RS256","kid":"unknown"}`, valid, keys.rsa),
+		},
+
+		// Time
+		{
+			name:  "expired",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()}), keys.rsa),
+		},
+		{
+			name:  "not valid yet",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()}), keys.rsa),
+		},
+		{
+			name:  "without exp",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": nil}), keys.rsa),
+		},
+		{
+			name:  "exp is a string",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": "tomorrow"}), keys.rsa),
+		},
+		{
+			name:  "exp is out of range",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": 1e300}), keys.rsa),
+		},
+		{
+			name:  "exp is negative",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"exp": -1}), keys.rsa),
+		},
+		{
+			name:  "nbf is a string",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"nbf": "yesterday"}), keys.rsa),
+		},
+
+		// Issuer, audience and subject
+		{
+			name:  "wrong issuer",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"iss": "https://evil.example.com"}), keys.rsa),
+		},
+		{
+			name:  "without issuer",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"iss": nil}), keys.rsa),
+		},
+		{
+			name:  "wrong audience",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"aud": "other"}), keys.rsa),
+		},
+		{
+			name:  "without audience",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"aud": nil}), keys.rsa),
+		},
+		{
+			name:  "without subject",
+			token: encodeToken(t, rs256, claimsJSON(t, now, map[string]interface{}{"sub": nil}), keys.rsa),
+		},
+
+		// Malformed segments
+		{
+			name:  "two segments",
+			token: "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJhbGljZSJ9",
+		},
+		{
+			name:  "four segments",
+			token: encodeToken(t, rs256, valid, keys.rsa) + ".x",
+		},
+		{
+			name:  "header isn't base64",
+			token: replaceHeader(encodeToken(t, rs256, valid, keys.rsa), "") + "!",
+		},
+		{
+			name:  "header isn't JSON",
+			token: encodeToken(t, `RS256`, valid, keys.rsa),
+		},
+		{
+			name:  "signature isn't base64",
+			token: encodeToken(t, rs256, valid, keys.rsa) + "!",
+		},
+		{
+			name:  "claims aren't JSON",
+			token: encodeToken(t, rs256, `{"sub":`, keys.rsa),
+		},
+		{
+			name:  "empty",
+			token: "",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifier.Authenticate(context.Background(), tt.token)
+
+			if tt.want == nil {
+				if errors.Cause(err) != librarian.ErrUnauthenticated {
+					t.Errorf("Authenticate() = %+v, %v, want %v", got, err, librarian.ErrUnauthenticated)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifierRequiresIssuerAndAudience(t *testing.T) {
+	keys := newTestKeys(t)
+	token := encodeToken(t, `{"alg":"RS256"}`, claimsJSON(t, time.Now(), nil), keys.rsa)
+
+	for name, verifier := range map[string]*Verifier{
+		"without issuer":   New([]Key{{ID: "", Public: &keys.rsa.PublicKey}}, WithAudience(testAudience)),
+		"without audience": New([]Key{{ID: "", Public: &keys.rsa.PublicKey}}, WithIssuer(testIssuer)),
+	} {
+		if _, err := verifier.Authenticate(context.Background(), token); errors.Cause(err) != librarian.ErrUnauthenticated {
+			t.Errorf("%s: Authenticate() error = %v, want %v", name, err, librarian.ErrUnauthenticated)
+		}
+	}
+}
+
+// replaceHeader replaces the header of the token and keeps its signature.
+func replaceHeader(token, header string) string {
+	i := 0
+	for i < len(token) && token[i] != '.' {
+		i++
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + token[i:]
+}
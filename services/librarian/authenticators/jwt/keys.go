@@ -0,0 +1,191 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Key is a public key which verifies signatures of tokens with the kid header
+// equal to its ID. Keys without ID verify tokens with any kid.
+type Key struct {
+	ID     string
+	Public crypto.PublicKey
+}
+
+// ParseKeys parses a JWKS document or PEM blocks with public keys and
+// certificates. PEM keys have no IDs.
+func ParseKeys(data []byte) ([]Key, error) {
+	var (
+		keys []Key
+		err  error
+	)
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		keys, err = parseJWKS(trimmed)
+	} else {
+		keys, err = parsePEM(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(data []byte) ([]Key, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, errors.Wrap(err, "cannot parse JWKS")
+	}
+
+	keys := make([]Key, 0, len(jwks.Keys))
+	for i, k := range jwks.Keys {
+		// NOTE: encryption keys can't verify signatures.
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.public()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid keys[%d]", i)
+		}
+
+		keys = append(keys, Key{ID: k.Kid, Public: pub})
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) public() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode n")
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode e")
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e is too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("curve %q is not supported", k.Crv)
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode x")
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode y")
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, errors.Errorf("key type %q is not supported", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("value is empty")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parsePEM(data []byte) ([]Key, error) {
+	var keys []Key
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var (
+			pub interface{}
+			err error
+		)
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			return nil, errors.Errorf("PEM block %q is not supported", block.Type)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse PEM block %q", block.Type)
+		}
+
+		switch pub.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, errors.Errorf("key of PEM block %q is not RSA or ECDSA", block.Type)
+		}
+
+		keys = append(keys, Key{ID: "", Public: pub})
+	}
+
+	return keys, nil
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -14,13 +16,104 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"github.com/shardhub/shards/services/librarian"
+	"github.com/shardhub/shards/services/librarian/api/health"
 	v1 "github.com/shardhub/shards/services/librarian/api/v1"
+	"github.com/shardhub/shards/services/librarian/config"
 	"github.com/shardhub/shards/services/librarian/databases/postgres"
+	"github.com/shardhub/shards/services/librarian/databases/sharded"
 
 	_ "github.com/lib/pq"
 )
 
+// backend is a postgres which has to be connected and inited.
+type backend struct {
+	name     string
+	postgres *postgres.Postgres
+}
+
+// newDatabase returns the database described by the config and postgres
+// backends it uses.
+func newDatabase(b config.Backend) (librarian.Database, []backend, error) {
+	switch b.Type {
+	case config.BackendTypeSharded:
+		shards := make([]sharded.Shard, 0, len(b.Sharded.Shards))
+		backends := make([]backend, 0, len(b.Sharded.Shards))
+
+		for _, s := range b.Sharded.Shards {
+			opts, err := s.Postgres.Options()
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "invalid shard %s", s.Name)
+			}
+
+			pg := postgres.New(opts...)
+
+			shards = append(shards, sharded.Shard{
+				Name:     s.Name,
+				Database: pg,
+			})
+			backends = append(backends, backend{
+				name:     b.Name + "/" + s.Name,
+				postgres: pg,
+			})
+		}
+
+		var strategy sharded.Strategy
+		switch b.Sharded.Strategy {
+		case config.StrategyRoundRobin:
+			strategy = sharded.NewRoundRobin()
+		case config.StrategyLeastDatabases:
+			strategy = sharded.NewLeastDatabases()
+		case config.StrategyConsistentHash:
+			strategy = sharded.NewConsistentHash(0)
+		}
+
+		opts := []sharded.Option{sharded.WithStrategy(strategy)}
+
+		// NOTE: the first shard keeps the catalog, so all instances must have
+		// the same first shard.
+		if len(backends) > 0 {
+			opts = append(opts, sharded.WithCatalog(backends[0].postgres))
+		}
+
+		database, err := sharded.New(shards, opts...)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid backend %s", b.Name)
+		}
+
+		return database, backends, nil
+
+	default:
+		opts, err := b.Postgres.Options()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pg := postgres.New(opts...)
+
+		return pg, []backend{{name: b.Name, postgres: pg}}, nil
+	}
+}
+
 func main() {
+	// Flags have priority over the config file and environment variables
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "path to YAML config file")
+	listen := flag.String("listen", "", "HTTP listen address, e.g. localhost:8080")
+	logLevel := flag.String("log-level", "", "log level: debug, info, warn or error")
+	flag.Parse()
+
+	// Load config
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot load config:", err)
+		os.Exit(1)
+	}
+	if *listen != "" {
+		cfg.HTTP.Listen = *listen
+	}
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
+	}
+
 	// Main context
 	g, ctx := errgroup.WithContext(context.Background())
 
@@ -29,72 +122,208 @@ func main() {
 	signal.Notify(sigch, os.Interrupt)
 
 	// Create logger
-	logger, err := zap.NewProduction() // TODO
+	logger, err := cfg.Log.Logger()
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "Cannot create logger:", err)
+		os.Exit(1)
 	}
 	defer logger.Sync() // nolint:errcheck
 
 	// Create librarian
 	l := librarian.New()
 
-	// TODO: Replace with real config
-	pg := postgres.New(
-		postgres.WithHost("localhost"),
-		postgres.WithPort(5432),
-		postgres.WithUsername("postgres"),
-		postgres.WithPassword(""),
-		postgres.WithSoftDelete(),
+	var (
+		backends []backend
+		pools    []*librarian.Pool
 	)
-	logger.Info("Register postgres")
-	if err := l.Register("postgres", pg); err != nil {
-		logger.Fatal("Cannot register postgres", zap.Error(err))
+	for _, b := range cfg.Backends {
+		database, bs, err := newDatabase(b)
+		if err != nil {
+			logger.Fatal("Cannot create backend", zap.String("backend", b.Name), zap.Error(err))
+		}
+
+		if b.Pool.Size > 0 {
+			opts := []librarian.PoolOption{
+				librarian.WithPoolSize(b.Pool.Size),
+				librarian.WithPoolLogger(logger.With(zap.String("backend", b.Name))),
+			}
+			if b.Pool.IdleTTL != 0 {
+				opts = append(opts, librarian.WithPoolIdleTTL(time.Duration(b.Pool.IdleTTL)))
+			}
+
+			pool := librarian.NewPool(database, opts...)
+			pools = append(pools, pool)
+			database = pool
+		}
+
+		logger.Info("Register backend", zap.String("backend", b.Name))
+		if err := l.Register(b.Name, database); err != nil {
+			logger.Fatal("Cannot register backend", zap.String("backend", b.Name), zap.Error(err))
+		}
+
+		backends = append(backends, bs...)
 	}
 
+	// Create reaper
+	reaper := librarian.NewReaper(l,
+		librarian.WithReaperInterval(time.Duration(cfg.Reaper.Interval)),
+		librarian.WithReaperJitter(time.Duration(cfg.Reaper.Jitter)),
+		librarian.WithReaperLogger(logger),
+	)
+
 	// Create API
-	api := v1.New(l, logger)
+	// NOTE: JWTs are verified first, so they don't hit the management DB.
+	var authenticators librarian.Authenticators
+	if cfg.Auth.JWT.Keys != "" {
+		verifier, err := cfg.Auth.JWT.Verifier()
+		if err != nil {
+			logger.Fatal("Cannot create JWT verifier", zap.Error(err))
+		}
+
+		logger.Info("Enable JWT authentication", zap.String("keys", cfg.Auth.JWT.Keys))
+		authenticators = append(authenticators, verifier)
+	}
+	if cfg.Auth.Tokens != "" {
+		for _, b := range backends {
+			if b.name == cfg.Auth.Tokens {
+				authenticators = append(authenticators, b.postgres)
+			}
+		}
+
+		logger.Info("Enable token authentication", zap.String("backend", cfg.Auth.Tokens))
+	}
+
+	// Create health probes
+	h := health.New(l, health.WithLogger(logger))
+
+	apiOpts := []v1.Option{
+		v1.WithReadiness(h.Ready),
+	}
+	if len(authenticators) > 0 {
+		// NOTE: the first backend keeps locks of quotas, so all instances
+		// must have the same first backend.
+		enforcer := librarian.NewEnforcer(l, cfg.Quotas.Quotas(),
+			librarian.WithEnforcerLocker(backends[0].postgres),
+		)
+
+		apiOpts = append(apiOpts,
+			v1.WithAuthenticator(authenticators),
+			v1.WithEnforcer(enforcer),
+		)
+	}
+
+	api := v1.New(l, logger, apiOpts...)
 
 	// Create router
 	r := chi.NewRouter()
+	r.Get("/healthz", h.HealthzHandler)
+	r.Get("/readyz", h.ReadyzHandler)
+	r.Get("/statsz", h.StatszHandler)
 	r.Mount("/api/v1", api)
 
 	// Create server
 	srv := &http.Server{
-		Addr:         "localhost" + ":" + strconv.Itoa(8080),
+		Addr:         cfg.HTTP.Listen,
 		Handler:      r,
-		ReadTimeout:  time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  time.Duration(cfg.HTTP.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.HTTP.WriteTimeout),
 	}
 
+	// Closed when all backends are ready to use
+	initialized := make(chan struct{})
+	// Reaper and pools which use backends
+	var workers sync.WaitGroup
+
+	g.Go(func() error {
+		for _, b := range backends {
+			logger := logger.With(zap.String("backend", b.name))
+
+			logger.Info("Connect to postgres")
+			if err := b.postgres.Connect(ctx); err != nil {
+				logger.Error("Cannot connect to postgres", zap.Error(err))
+				return errors.Wrapf(err, "cannot connect to postgres %s", b.name)
+			}
+			logger.Info("Connected to postgres")
+
+			logger.Info("Init postgres")
+			if err := b.postgres.Init(ctx); err != nil {
+				logger.Error("Cannot init postgres", zap.Error(err))
+				return errors.Wrapf(err, "cannot init postgres %s", b.name)
+			}
+			logger.Info("Postgres was inited")
+		}
+
+		close(initialized)
+		h.SetReady()
+		logger.Info("Librarian is ready")
+
+		return nil
+	})
+
+	workers.Add(1)
 	g.Go(func() error {
-		logger.Info("Connect to postgres")
-		if err := pg.Connect(ctx); err != nil {
-			logger.Error("Cannot connect to postgres", zap.Error(err))
-			return errors.Wrap(err, "cannot connect to postgres")
+		defer workers.Done()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-initialized:
 		}
-		logger.Info("Connected to postgres")
 
-		logger.Info("Init postgres")
-		if err := pg.Init(ctx); err != nil {
-			logger.Error("Cannot init postgres", zap.Error(err))
-			return errors.Wrap(err, "cannot init postgres")
+		logger.Info("Start reaper")
+		if err := reaper.Run(ctx); err != nil {
+			logger.Error("Reaper was stopped with error", zap.Error(err))
+			return errors.Wrap(err, "reaper was stopped with error")
 		}
-		logger.Info("Postgres was inited")
+		logger.Info("Reaper was stopped")
 
 		return nil
 	})
 
+	for _, pool := range pools {
+		pool := pool
+
+		workers.Add(1)
+		g.Go(func() error {
+			defer workers.Done()
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-initialized:
+			}
+
+			logger.Info("Start pool")
+			if err := pool.Run(ctx); err != nil {
+				logger.Error("Pool was stopped with error", zap.Error(err))
+				return errors.Wrap(err, "pool was stopped with error")
+			}
+			logger.Info("Pool was stopped", zap.Uint64("hits", pool.Stats().Hits), zap.Uint64("misses", pool.Stats().Misses))
+
+			return nil
+		})
+	}
+
 	g.Go(func() error {
 		<-ctx.Done()
+		// NOTE: reaper runs the final pass and pools delete their DBs on
+		// shutdown, so we have to wait for them.
+		workers.Wait()
 
-		logger.Info("Disconnect from postgres")
-		if err := pg.Disconnect(); err != nil {
-			logger.Error("Cannot disconnect from postgres", zap.Error(err))
-			return errors.Wrap(err, "cannot disconnect from postgres")
+		var gerr error
+		for _, b := range backends {
+			logger := logger.With(zap.String("backend", b.name))
+
+			logger.Info("Disconnect from postgres")
+			if err := b.postgres.Disconnect(); err != nil {
+				logger.Error("Cannot disconnect from postgres", zap.Error(err))
+				gerr = errors.Wrapf(err, "cannot disconnect from postgres %s", b.name)
+				continue
+			}
+			logger.Info("Disconnected from postgres")
 		}
-		logger.Info("Disconnected from postgres")
 
-		return nil
+		return gerr
 	})
 
 	g.Go(func() error {
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian/config"
+	"github.com/shardhub/shards/services/librarian/databases/postgres"
+
+	_ "github.com/lib/pq"
+)
+
+// Creates and revokes API tokens in the backend from auth.tokens of the config.
+func main() {
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "path to YAML config file")
+	backend := flag.String("backend", "", "postgres backend which stores tokens, auth.tokens of the config by default")
+	tenant := flag.String("tenant", "", "tenant of the new token")
+	name := flag.String("name", "", "name of the new token, e.g. its owner")
+	admin := flag.Bool("admin", false, "the new token has access to DBs of all tenants")
+	revoke := flag.Int("revoke", 0, "ID of the token to revoke")
+	flag.Parse()
+
+	if err := run(*configPath, *backend, *tenant, *name, *admin, *revoke); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath, backend, tenant, name string, admin bool, revoke int) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return errors.Wrap(err, "cannot load config")
+	}
+
+	if backend == "" {
+		backend = cfg.Auth.Tokens
+	}
+	if backend == "" {
+		return errors.New("backend is not set, use -backend or auth.tokens of the config")
+	}
+
+	c, ok := cfg.PostgresBackend(backend)
+	if !ok {
+		return errors.Errorf("%q is not a postgres backend or shard", backend)
+	}
+
+	opts, err := c.Options()
+	if err != nil {
+		return errors.Wrap(err, "invalid backend")
+	}
+
+	ctx := context.Background()
+	pg := postgres.New(opts...)
+
+	if err := pg.Connect(ctx); err != nil {
+		return errors.Wrap(err, "cannot connect to postgres")
+	}
+	defer pg.Disconnect() // nolint:errcheck
+
+	if err := pg.Init(ctx); err != nil {
+		return errors.Wrap(err, "cannot init postgres")
+	}
+
+	if revoke != 0 {
+		if err := pg.RevokeToken(ctx, revoke); err != nil {
+			return err
+		}
+
+		fmt.Println("Token", revoke, "was revoked")
+
+		return nil
+	}
+
+	id, token, err := pg.CreateToken(ctx, name, tenant, admin)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ID:   ", id)
+	fmt.Println("Token:", token)
+
+	return nil
+}
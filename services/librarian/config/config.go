@@ -0,0 +1,625 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+
+	"github.com/shardhub/shards/services/librarian"
+	"github.com/shardhub/shards/services/librarian/authenticators/jwt"
+	"github.com/shardhub/shards/services/librarian/databases/postgres"
+)
+
+// EnvPrefix is the prefix of environment variables which override the config
+// file, e.g. LIBRARIAN_HTTP_LISTEN or LIBRARIAN_BACKENDS_POSTGRES_PASSWORD.
+const EnvPrefix = "LIBRARIAN_"
+
+const (
+	BackendTypePostgres = "postgres"
+	BackendTypeSharded  = "sharded"
+)
+
+const (
+	StrategyRoundRobin     = "round-robin"
+	StrategyLeastDatabases = "least-databases"
+	StrategyConsistentHash = "consistent-hash"
+)
+
+type Config struct {
+	HTTP     HTTP      `yaml:"http"`
+	Log      Log       `yaml:"log"`
+	Reaper   Reaper    `yaml:"reaper"`
+	Auth     Auth      `yaml:"auth"`
+	Quotas   Quotas    `yaml:"quotas"`
+	Backends []Backend `yaml:"backends"`
+}
+
+type HTTP struct {
+	Listen       string   `yaml:"listen"`
+	ReadTimeout  Duration `yaml:"readTimeout"`
+	WriteTimeout Duration `yaml:"writeTimeout"`
+}
+
+type Log struct {
+	// One of debug, info, warn, error
+	Level       string `yaml:"level"`
+	Development bool   `yaml:"development"`
+}
+
+type Reaper struct {
+	Interval Duration `yaml:"interval"`
+	Jitter   Duration `yaml:"jitter"`
+}
+
+type Auth struct {
+	// Postgres backend which stores API tokens, e.g. "postgres" or
+	// "ci/shard-1" for a shard. Set empty to disable authentication.
+	Tokens string `yaml:"tokens"`
+	JWT    JWT    `yaml:"jwt"`
+}
+
+// JWT verifies bearer tokens which are issued by an IdP. It's disabled if
+// keys is empty.
+type JWT struct {
+	// Path of a JWKS or PEM file with public keys of the issuer
+	Keys string `yaml:"keys"`
+	// Required values of iss and aud claims
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Claims which are mapped to the tenant and groups, sub and groups by
+	// default
+	TenantClaim string `yaml:"tenantClaim"`
+	GroupsClaim string `yaml:"groupsClaim"`
+	// Members of the groups see and manage DBs of all tenants
+	AdminGroups []string `yaml:"adminGroups"`
+	// Allowed clock skew for exp and nbf
+	Leeway Duration `yaml:"leeway"`
+}
+
+// Verifier reads keys and returns the JWT verifier.
+func (c *JWT) Verifier() (*jwt.Verifier, error) {
+	data, err := ioutil.ReadFile(c.Keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read keys")
+	}
+
+	keys, err := jwt.ParseKeys(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse keys %s", c.Keys)
+	}
+
+	opts := []jwt.Option{
+		jwt.WithIssuer(c.Issuer),
+		jwt.WithAudience(c.Audience),
+	}
+	if c.TenantClaim != "" {
+		opts = append(opts, jwt.WithTenantClaim(c.TenantClaim))
+	}
+	if c.GroupsClaim != "" {
+		opts = append(opts, jwt.WithGroupsClaim(c.GroupsClaim))
+	}
+	if len(c.AdminGroups) > 0 {
+		opts = append(opts, jwt.WithAdminGroups(c.AdminGroups...))
+	}
+	if c.Leeway != 0 {
+		opts = append(opts, jwt.WithLeeway(time.Duration(c.Leeway)))
+	}
+
+	return jwt.New(keys, opts...), nil
+}
+
+// Quotas limit DBs of tenants, so they require authentication. Tenants
+// without their own quota get the default one.
+type Quotas struct {
+	Default Quota            `yaml:"default"`
+	Tenants map[string]Quota `yaml:"tenants"`
+}
+
+// Quota of a tenant, zero values are unlimited.
+type Quota struct {
+	MaxDatabases int      `yaml:"maxDatabases"`
+	MaxTTL       Duration `yaml:"maxTTL"`
+	MaxDBHours   int      `yaml:"maxDBHours"`
+}
+
+func (c *Quotas) Quotas() *librarian.Quotas {
+	tenants := make(map[string]librarian.Quota, len(c.Tenants))
+	for tenant, q := range c.Tenants {
+		tenants[tenant] = q.Quota()
+	}
+
+	return &librarian.Quotas{
+		Default: c.Default.Quota(),
+		Tenants: tenants,
+	}
+}
+
+func (c *Quota) Quota() librarian.Quota {
+	return librarian.Quota{
+		MaxDatabases: c.MaxDatabases,
+		MaxTTL:       time.Duration(c.MaxTTL),
+		MaxDBHours:   c.MaxDBHours,
+	}
+}
+
+func (c *Quota) Validate() error {
+	if c.MaxDatabases < 0 {
+		return errors.New("maxDatabases must not be negative")
+	}
+	if c.MaxTTL < 0 {
+		return errors.New("maxTTL must not be negative")
+	}
+	if c.MaxDBHours < 0 {
+		return errors.New("maxDBHours must not be negative")
+	}
+
+	return nil
+}
+
+// Backend is a database registered in the librarian by its name.
+type Backend struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"`
+	Postgres Postgres `yaml:"postgres"`
+	Sharded  Sharded  `yaml:"sharded"`
+	Pool     Pool     `yaml:"pool"`
+}
+
+// Pool of pre-created DBs, it's disabled if size is `0`.
+type Pool struct {
+	Size    int      `yaml:"size"`
+	IdleTTL Duration `yaml:"idleTTL"`
+}
+
+// Sharded is a backend which places DBs on several postgres shards.
+type Sharded struct {
+	// One of round-robin, least-databases, consistent-hash
+	Strategy string  `yaml:"strategy"`
+	Shards   []Shard `yaml:"shards"`
+}
+
+type Shard struct {
+	Name     string   `yaml:"name"`
+	Postgres Postgres `yaml:"postgres"`
+}
+
+type Postgres struct {
+	Scheme             string   `yaml:"scheme"`
+	Host               string   `yaml:"host"`
+	Port               int      `yaml:"port"`
+	Username           string   `yaml:"username"`
+	Password           string   `yaml:"password"`
+	ManagementDatabase string   `yaml:"managementDatabase"`
+	SoftDelete         bool     `yaml:"softDelete"`
+	MaxLifetime        Duration `yaml:"maxLifetime"`
+	// Databases which users can use as templates
+	Templates []string `yaml:"templates"`
+	// How long templates built from migrations are kept after last use
+	TemplateTTL Duration `yaml:"templateTTL"`
+	// Paths of SQL scripts which are executed in order in every new DB
+	Seeds []string `yaml:"seeds"`
+}
+
+func (c *Postgres) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return errors.Errorf("port %d is out of range", c.Port)
+	}
+	if c.MaxLifetime < 0 {
+		return errors.New("maxLifetime must not be negative")
+	}
+	if c.TemplateTTL < 0 {
+		return errors.New("templateTTL must not be negative")
+	}
+
+	return nil
+}
+
+// Options converts the config to postgres options. Empty values are left to
+// postgres defaults. Seed scripts are read from files here.
+func (c *Postgres) Options() ([]postgres.Option, error) {
+	var opts []postgres.Option
+
+	if c.Scheme != "" {
+		opts = append(opts, postgres.WithScheme(c.Scheme))
+	}
+	if c.Host != "" {
+		opts = append(opts, postgres.WithHost(c.Host))
+	}
+	if c.Port != 0 {
+		opts = append(opts, postgres.WithPort(c.Port))
+	}
+	if c.Username != "" {
+		opts = append(opts, postgres.WithUsername(c.Username))
+	}
+	if c.Password != "" {
+		opts = append(opts, postgres.WithPassword(c.Password))
+	}
+	if c.ManagementDatabase != "" {
+		opts = append(opts, postgres.WithManagementDatabase(c.ManagementDatabase))
+	}
+	if c.SoftDelete {
+		opts = append(opts, postgres.WithSoftDelete())
+	}
+	if c.MaxLifetime != 0 {
+		opts = append(opts, postgres.WithMaxLifetime(time.Duration(c.MaxLifetime)))
+	}
+	if len(c.Templates) > 0 {
+		opts = append(opts, postgres.WithTemplates(c.Templates...))
+	}
+	if c.TemplateTTL != 0 {
+		opts = append(opts, postgres.WithTemplateTTL(time.Duration(c.TemplateTTL)))
+	}
+	if len(c.Seeds) > 0 {
+		seeds := make([]postgres.Seed, 0, len(c.Seeds))
+
+		for _, path := range c.Seeds {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot read seed %s", path)
+			}
+
+			seeds = append(seeds, postgres.Seed{Name: filepath.Base(path), SQL: string(data)})
+		}
+
+		opts = append(opts, postgres.WithSeeds(seeds...))
+	}
+
+	return opts, nil
+}
+
+// Duration is time.Duration which is written as "1m30s" in the config.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return errors.Wrap(err, "cannot unmarshal duration")
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse duration")
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Default returns the config which is used without a config file: one local
+// postgres backend.
+func Default() *Config {
+	return &Config{
+		HTTP: HTTP{
+			Listen:       "localhost:8080",
+			ReadTimeout:  Duration(time.Second),
+			WriteTimeout: Duration(10 * time.Second),
+		},
+		Log: Log{
+			Level:       "info",
+			Development: false,
+		},
+		Reaper: Reaper{
+			Interval: Duration(time.Minute),
+			Jitter:   Duration(10 * time.Second),
+		},
+		Auth: Auth{
+			Tokens: "",
+		},
+		Backends: []Backend{
+			{
+				Name: "postgres",
+				Type: BackendTypePostgres,
+				Postgres: Postgres{
+					Host:        "localhost",
+					Port:        5432,
+					Username:    "postgres",
+					Password:    "",
+					SoftDelete:  true,
+					MaxLifetime: Duration(24 * time.Hour),
+				},
+			},
+		},
+	}
+}
+
+// Load reads the config file if path is not empty, then applies environment
+// variables and validates the result.
+func Load(path string) (*Config, error) {
+	c := Default()
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read config file")
+		}
+
+		// NOTE: backends from the file replace the default ones.
+		c.Backends = nil
+
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, errors.Wrap(err, "cannot parse config file")
+		}
+	}
+
+	if err := c.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, errors.Wrap(err, "cannot apply environment variables")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	return c, nil
+}
+
+// ApplyEnv overrides the config with variables returned by lookup.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	e := &env{lookup: lookup}
+
+	e.String("HTTP_LISTEN", &c.HTTP.Listen)
+	e.Duration("HTTP_READ_TIMEOUT", &c.HTTP.ReadTimeout)
+	e.Duration("HTTP_WRITE_TIMEOUT", &c.HTTP.WriteTimeout)
+
+	e.String("LOG_LEVEL", &c.Log.Level)
+	e.Bool("LOG_DEVELOPMENT", &c.Log.Development)
+
+	e.Duration("REAPER_INTERVAL", &c.Reaper.Interval)
+	e.Duration("REAPER_JITTER", &c.Reaper.Jitter)
+
+	e.String("AUTH_TOKENS", &c.Auth.Tokens)
+	e.String("AUTH_JWT_KEYS", &c.Auth.JWT.Keys)
+	e.String("AUTH_JWT_ISSUER", &c.Auth.JWT.Issuer)
+	e.String("AUTH_JWT_AUDIENCE", &c.Auth.JWT.Audience)
+
+	for i := range c.Backends {
+		b := &c.Backends[i]
+		prefix := "BACKENDS_" + envName(b.Name) + "_"
+
+		e.Postgres(prefix, &b.Postgres)
+		e.Int(prefix+"POOL_SIZE", &b.Pool.Size)
+
+		for j := range b.Sharded.Shards {
+			shard := &b.Sharded.Shards[j]
+
+			e.Postgres(prefix+"SHARDS_"+envName(shard.Name)+"_", &shard.Postgres)
+		}
+	}
+
+	return e.err
+}
+
+func (c *Config) Validate() error {
+	if c.HTTP.Listen == "" {
+		return errors.New("http.listen is empty")
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		return errors.Errorf("log.level %q is unknown", c.Log.Level)
+	}
+
+	if c.HTTP.ReadTimeout < 0 || c.HTTP.WriteTimeout < 0 {
+		return errors.New("http.readTimeout and http.writeTimeout must not be negative")
+	}
+
+	if c.Reaper.Interval <= 0 {
+		return errors.New("reaper.interval must be positive")
+	}
+	if c.Reaper.Jitter < 0 {
+		return errors.New("reaper.jitter must not be negative")
+	}
+
+	if len(c.Backends) == 0 {
+		return errors.New("no backends")
+	}
+
+	names := make(map[string]bool, len(c.Backends))
+	for i, b := range c.Backends {
+		if b.Name == "" {
+			return errors.Errorf("backends[%d].name is empty", i)
+		}
+		if names[b.Name] {
+			return errors.Errorf("backends[%d].name %q is duplicated", i, b.Name)
+		}
+		names[b.Name] = true
+
+		switch b.Type {
+		case BackendTypePostgres:
+			if err := b.Postgres.Validate(); err != nil {
+				return errors.Wrapf(err, "invalid backends[%d].postgres", i)
+			}
+		case BackendTypeSharded:
+			if err := b.Sharded.Validate(); err != nil {
+				return errors.Wrapf(err, "invalid backends[%d].sharded", i)
+			}
+		default:
+			return errors.Errorf("backends[%d].type %q is unknown", i, b.Type)
+		}
+
+		if b.Pool.Size < 0 {
+			return errors.Errorf("backends[%d].pool.size must not be negative", i)
+		}
+		if b.Pool.IdleTTL < 0 {
+			return errors.Errorf("backends[%d].pool.idleTTL must not be negative", i)
+		}
+	}
+
+	if c.Auth.Tokens != "" {
+		if _, ok := c.PostgresBackend(c.Auth.Tokens); !ok {
+			return errors.Errorf("auth.tokens %q is not a postgres backend or shard", c.Auth.Tokens)
+		}
+	}
+
+	if c.Auth.JWT.Keys != "" && (c.Auth.JWT.Issuer == "" || c.Auth.JWT.Audience == "") {
+		return errors.New("auth.jwt.issuer and auth.jwt.audience are required with auth.jwt.keys")
+	}
+	if c.Auth.JWT.Leeway < 0 {
+		return errors.New("auth.jwt.leeway must not be negative")
+	}
+
+	if err := c.Quotas.Default.Validate(); err != nil {
+		return errors.Wrap(err, "invalid quotas.default")
+	}
+	for tenant, q := range c.Quotas.Tenants {
+		if err := q.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid quotas.tenants[%s]", tenant)
+		}
+	}
+
+	return nil
+}
+
+// PostgresBackend returns the postgres config of the backend with the given
+// name. Shards are named "backend/shard".
+func (c *Config) PostgresBackend(name string) (*Postgres, bool) {
+	for i := range c.Backends {
+		b := &c.Backends[i]
+
+		switch b.Type {
+		case BackendTypePostgres:
+			if b.Name == name {
+				return &b.Postgres, true
+			}
+		case BackendTypeSharded:
+			for j := range b.Sharded.Shards {
+				if b.Name+"/"+b.Sharded.Shards[j].Name == name {
+					return &b.Sharded.Shards[j].Postgres, true
+				}
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func (c *Sharded) Validate() error {
+	switch c.Strategy {
+	case StrategyRoundRobin, StrategyLeastDatabases, StrategyConsistentHash:
+	default:
+		return errors.Errorf("strategy %q is unknown", c.Strategy)
+	}
+
+	if len(c.Shards) == 0 {
+		return errors.New("no shards")
+	}
+
+	names := make(map[string]bool, len(c.Shards))
+	for i, s := range c.Shards {
+		if s.Name == "" {
+			return errors.Errorf("shards[%d].name is empty", i)
+		}
+		if names[s.Name] {
+			return errors.Errorf("shards[%d].name %q is duplicated", i, s.Name)
+		}
+		names[s.Name] = true
+
+		if err := s.Postgres.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid shards[%d].postgres", i)
+		}
+	}
+
+	return nil
+}
+
+// envName converts a backend name to a part of an environment variable name,
+// e.g. "pg-eu" to "PG_EU".
+func envName(name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// env collects the first error, so variables can be applied one by one.
+type env struct {
+	lookup func(string) (string, bool)
+	err    error
+}
+
+func (e *env) String(name string, v *string) {
+	if s, ok := e.lookup(EnvPrefix + name); ok {
+		*v = s
+	}
+}
+
+func (e *env) Postgres(prefix string, c *Postgres) {
+	e.String(prefix+"HOST", &c.Host)
+	e.Int(prefix+"PORT", &c.Port)
+	e.String(prefix+"USERNAME", &c.Username)
+	e.String(prefix+"PASSWORD", &c.Password)
+	e.String(prefix+"MANAGEMENT_DATABASE", &c.ManagementDatabase)
+}
+
+func (e *env) Int(name string, v *int) {
+	s, ok := e.lookup(EnvPrefix + name)
+	if !ok || e.err != nil {
+		return
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		e.err = errors.Wrapf(err, "cannot parse %s", EnvPrefix+name)
+		return
+	}
+
+	*v = i
+}
+
+func (e *env) Bool(name string, v *bool) {
+	s, ok := e.lookup(EnvPrefix + name)
+	if !ok || e.err != nil {
+		return
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		e.err = errors.Wrapf(err, "cannot parse %s", EnvPrefix+name)
+		return
+	}
+
+	*v = b
+}
+
+func (e *env) Duration(name string, v *Duration) {
+	s, ok := e.lookup(EnvPrefix + name)
+	if !ok || e.err != nil {
+		return
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		e.err = errors.Wrapf(err, "cannot parse %s", EnvPrefix+name)
+		return
+	}
+
+	*v = Duration(d)
+}
+
+// Logger builds a logger with the configured level.
+func (c *Log) Logger() (*zap.Logger, error) {
+	cfg := zap.NewProductionConfig()
+	if c.Development {
+		cfg = zap.NewDevelopmentConfig()
+	}
+
+	if err := cfg.Level.UnmarshalText([]byte(c.Level)); err != nil {
+		return nil, errors.Wrap(err, "cannot parse log level")
+	}
+
+	logger, err := cfg.Build()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build logger")
+	}
+
+	return logger, nil
+}
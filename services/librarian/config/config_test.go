@@ -0,0 +1,410 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes the config to a temporary file, remove it with the
+// returned function.
+func writeConfig(t *testing.T, data string) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "librarian-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		os.RemoveAll(dir) // nolint:errcheck,gosec
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) } // nolint:errcheck,gosec
+}
+
+// setenv sets environment variables, restore them with the returned function.
+func setenv(t *testing.T, vars map[string]string) func() {
+	t.Helper()
+
+	old := make(map[string]*string, len(vars))
+	for name, value := range vars {
+		if v, ok := os.LookupEnv(name); ok {
+			old[name] = &v
+		} else {
+			old[name] = nil
+		}
+
+		if err := os.Setenv(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return func() {
+		for name, v := range old {
+			if v == nil {
+				os.Unsetenv(name) // nolint:errcheck,gosec
+			} else {
+				os.Setenv(name, *v) // nolint:errcheck,gosec
+			}
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	c := Default()
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	if c.HTTP.Listen != "localhost:8080" {
+		t.Errorf("http.listen = %q, want localhost:8080", c.HTTP.Listen)
+	}
+	if c.Reaper.Interval != Duration(time.Minute) || c.Reaper.Jitter != Duration(10*time.Second) {
+		t.Errorf("reaper = %+v, want interval 1m and jitter 10s", c.Reaper)
+	}
+	if c.Auth.Tokens != "" || c.Auth.JWT.Keys != "" {
+		t.Errorf("auth = %+v, want disabled", c.Auth)
+	}
+
+	if len(c.Backends) != 1 {
+		t.Fatalf("%d backends, want 1", len(c.Backends))
+	}
+	if b := c.Backends[0]; b.Name != "postgres" || b.Type != BackendTypePostgres || b.Postgres.Port != 5432 || !b.Postgres.SoftDelete {
+		t.Errorf("backend = %+v, want local postgres with soft delete", b)
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	c, err := Load("example.yml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(c.Backends) != 2 {
+		t.Fatalf("%d backends, want 2 of the file instead of the default one", len(c.Backends))
+	}
+	if c.Backends[1].Sharded.Strategy != StrategyLeastDatabases || len(c.Backends[1].Sharded.Shards) != 2 {
+		t.Errorf("sharded backend = %+v", c.Backends[1].Sharded)
+	}
+	if q := c.Quotas.Tenants["ci"]; q.MaxDatabases != 50 || q.MaxTTL != Duration(2*time.Hour) {
+		t.Errorf("quota of ci = %+v", q)
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "unknown key",
+			data: "http:\n    listen: localhost:8080\n    lsiten: localhost:9090\n",
+		},
+		{
+			name: "unknown section",
+			data: "metrics:\n    enabled: true\n",
+		},
+		{
+			name: "unknown postgres key",
+			data: "backends:\n    - name: pg\n      type: postgres\n      postgres:\n          hostname: localhost\n",
+		},
+		{
+			name: "bad duration",
+			data: "reaper:\n    interval: often\n",
+		},
+		{
+			name: "duration without unit",
+			data: "reaper:\n    interval: 60\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path, remove := writeConfig(t, tt.data)
+			defer remove()
+
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "cannot parse config file") {
+				t.Errorf("Load() error = %v, want parse error", err)
+			}
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	path, remove := writeConfig(t, `
+http:
+    listen: localhost:8080
+reaper:
+    interval: 1m
+backends:
+    - name: pg-eu
+      type: postgres
+      postgres:
+          host: localhost
+          password: secret
+      pool:
+          size: 1
+    - name: ci
+      type: sharded
+      sharded:
+          strategy: round-robin
+          shards:
+              - name: pg-1
+                postgres:
+                    host: pg-1.local
+`)
+	defer remove()
+
+	defer setenv(t, map[string]string{
+		"LIBRARIAN_HTTP_LISTEN":                  ":9090",
+		"LIBRARIAN_REAPER_INTERVAL":              "5m",
+		"LIBRARIAN_LOG_DEVELOPMENT":              "true",
+		"LIBRARIAN_BACKENDS_PG_EU_PASSWORD":      "from-env",
+		"LIBRARIAN_BACKENDS_PG_EU_PORT":          "5433",
+		"LIBRARIAN_BACKENDS_PG_EU_POOL_SIZE":     "3",
+		"LIBRARIAN_BACKENDS_CI_SHARDS_PG_1_HOST": "pg-1.internal",
+	})()
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	got := []interface{}{
+		c.HTTP.Listen,
+		c.Reaper.Interval,
+		c.Log.Development,
+		c.Backends[0].Postgres.Password,
+		c.Backends[0].Postgres.Port,
+		c.Backends[0].Pool.Size,
+		c.Backends[1].Sharded.Shards[0].Postgres.Host,
+	}
+	want := []interface{}{
+		":9090",
+		Duration(5 * time.Minute),
+		true,
+		"from-env",
+		5433,
+		3,
+		"pg-1.internal",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %v, want %v", got, want)
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"LIBRARIAN_REAPER_INTERVAL":             "often",
+		"LIBRARIAN_LOG_DEVELOPMENT":             "maybe",
+		"LIBRARIAN_BACKENDS_POSTGRES_PORT":      "pg",
+		"LIBRARIAN_BACKENDS_POSTGRES_POOL_SIZE": "1.5",
+	} {
+		lookup := func(key string) (string, bool) {
+			if key == name {
+				return value, true
+			}
+			return "", false
+		}
+
+		if err := Default().ApplyEnv(lookup); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s=%s: ApplyEnv() error = %v, want error about the variable", name, value, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sharded := func(shards ...Shard) Backend {
+		return Backend{
+			Name:    "ci",
+			Type:    BackendTypeSharded,
+			Sharded: Sharded{Strategy: StrategyRoundRobin, Shards: shards},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{
+			name:   "empty listen",
+			modify: func(c *Config) { c.HTTP.Listen = "" },
+			want:   "http.listen is empty",
+		},
+		{
+			name:   "negative timeout",
+			modify: func(c *Config) { c.HTTP.WriteTimeout = Duration(-time.Second) },
+			want:   "http.readTimeout and http.writeTimeout must not be negative",
+		},
+		{
+			name:   "unknown log level",
+			modify: func(c *Config) { c.Log.Level = "verbose" },
+			want:   `log.level "verbose" is unknown`,
+		},
+		{
+			name:   "zero reaper interval",
+			modify: func(c *Config) { c.Reaper.Interval = 0 },
+			want:   "reaper.interval must be positive",
+		},
+		{
+			name:   "negative reaper jitter",
+			modify: func(c *Config) { c.Reaper.Jitter = Duration(-time.Second) },
+			want:   "reaper.jitter must not be negative",
+		},
+		{
+			name:   "no backends",
+			modify: func(c *Config) { c.Backends = nil },
+			want:   "no backends",
+		},
+		{
+			name:   "duplicated backend",
+			modify: func(c *Config) { c.Backends = append(c.Backends, c.Backends[0]) },
+			want:   `backends[1].name "postgres" is duplicated`,
+		},
+		{
+			name:   "unknown backend type",
+			modify: func(c *Config) { c.Backends[0].Type = "mysql" },
+			want:   `backends[0].type "mysql" is unknown`,
+		},
+		{
+			name:   "negative max lifetime",
+			modify: func(c *Config) { c.Backends[0].Postgres.MaxLifetime = Duration(-time.Hour) },
+			want:   "invalid backends[0].postgres: maxLifetime must not be negative",
+		},
+		{
+			name:   "port out of range",
+			modify: func(c *Config) { c.Backends[0].Postgres.Port = 70000 },
+			want:   "invalid backends[0].postgres: port 70000 is out of range",
+		},
+		{
+			name:   "negative pool idle TTL",
+			modify: func(c *Config) { c.Backends[0].Pool.IdleTTL = Duration(-time.Minute) },
+			want:   "backends[0].pool.idleTTL must not be negative",
+		},
+		{
+			name:   "no shards",
+			modify: func(c *Config) { c.Backends = []Backend{sharded()} },
+			want:   "invalid backends[0].sharded: no shards",
+		},
+		{
+			name: "unknown strategy",
+			modify: func(c *Config) {
+				b := sharded(Shard{Name: "pg-1", Postgres: Postgres{}})
+				b.Sharded.Strategy = "random"
+				c.Backends = []Backend{b}
+			},
+			want: `invalid backends[0].sharded: strategy "random" is unknown`,
+		},
+		{
+			name: "negative max lifetime of shard",
+			modify: func(c *Config) {
+				c.Backends = []Backend{sharded(Shard{Name: "pg-1", Postgres: Postgres{MaxLifetime: Duration(-time.Hour)}})}
+			},
+			want: "invalid backends[0].sharded: invalid shards[0].postgres: maxLifetime must not be negative",
+		},
+		{
+			name:   "unknown tokens backend",
+			modify: func(c *Config) { c.Auth.Tokens = "mysql" },
+			want:   `auth.tokens "mysql" is not a postgres backend or shard`,
+		},
+		{
+			name:   "JWT without issuer",
+			modify: func(c *Config) { c.Auth.JWT = JWT{Keys: "keys.pem", Audience: "librarian"} },
+			want:   "auth.jwt.issuer and auth.jwt.audience are required with auth.jwt.keys",
+		},
+		{
+			name:   "negative quota",
+			modify: func(c *Config) { c.Quotas.Tenants = map[string]Quota{"ci": {MaxDatabases: -1}} },
+			want:   "invalid quotas.tenants[ci]: maxDatabases must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+
+			if err := c.Validate(); err == nil || err.Error() != tt.want {
+				t.Errorf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresBackend(t *testing.T) {
+	c := Default()
+	c.Backends = append(c.Backends, Backend{
+		Name: "ci",
+		Type: BackendTypeSharded,
+		Sharded: Sharded{
+			Strategy: StrategyRoundRobin,
+			Shards:   []Shard{{Name: "pg-1", Postgres: Postgres{Host: "pg-1.local"}}},
+		},
+	})
+
+	if p, ok := c.PostgresBackend("postgres"); !ok || p.Host != "localhost" {
+		t.Errorf("PostgresBackend(postgres) = %+v, %t", p, ok)
+	}
+	if p, ok := c.PostgresBackend("ci/pg-1"); !ok || p.Host != "pg-1.local" {
+		t.Errorf("PostgresBackend(ci/pg-1) = %+v, %t", p, ok)
+	}
+	if _, ok := c.PostgresBackend("ci"); ok {
+		t.Error("sharded backend is a postgres backend")
+	}
+}
+
+func TestPostgresOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "librarian-seeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint:errcheck
+
+	seed := filepath.Join(dir, "fixtures.sql")
+	if err := ioutil.WriteFile(seed, []byte("CREATE TABLE fixtures (id INT);"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := (&Postgres{}).Options()
+	if err != nil || len(opts) != 0 {
+		t.Errorf("Options() of empty config = %d options, %v, want none", len(opts), err)
+	}
+
+	c := &Postgres{
+		Scheme:             "postgres",
+		Host:               "localhost",
+		Port:               5432,
+		Username:           "postgres",
+		Password:           "secret",
+		ManagementDatabase: "librarian",
+		SoftDelete:         true,
+		MaxLifetime:        Duration(24 * time.Hour),
+		Templates:          []string{"app_schema"},
+		TemplateTTL:        Duration(time.Hour),
+		Seeds:              []string{seed},
+	}
+
+	opts, err = c.Options()
+	if err != nil {
+		t.Fatalf("Options() error = %v", err)
+	}
+	if len(opts) != 11 {
+		t.Errorf("Options() = %d options, want 11", len(opts))
+	}
+
+	c.Seeds = []string{filepath.Join(dir, "missing.sql")}
+	if _, err := c.Options(); err == nil {
+		t.Error("Options() with a missing seed succeeded")
+	}
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// Clone creates a copy of the DB with its own user, password and TTL. Objects
+// of users of the source DB are owned by the new user in the copy, privileges
+// of users of the source DB are revoked in the copy.
+//
+// Postgres can copy only databases without connections, so connections to
+// the source DB are terminated. If somebody connects again before the copy is
+// made, Clone fails with librarian.ErrConflict and can be retried.
+func (p *Postgres) Clone(ctx context.Context, id string, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	options := librarian.NewCreaterOptions(opts...)
+
+	if options.Template != "" || len(options.Migrations) > 0 {
+		return nil, errors.Wrap(librarian.ErrInvalidInput, "template and migrations can't be used with clone")
+	}
+
+	now := nowFunc()
+
+	source, err := p.get(ctx, p.managementDB, id, false)
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot get source DB")
+	}
+	if source.DeletedAt != nil {
+		return nil, errors.Wrapf(librarian.ErrNotFound, "DB %s is already deleted", id)
+	}
+	if source.ExpiredAt != nil && !source.ExpiredAt.After(now) {
+		return nil, errors.Wrapf(librarian.ErrNotFound, "DB %s is already expired", id)
+	}
+
+	database := options.Database
+	if database == "" {
+		database = options.DBNameGenerator()
+	}
+
+	username := options.Username
+	if username == "" {
+		username = options.UsernameGenerator()
+	}
+
+	password := ""
+	if options.Password != nil {
+		password = *options.Password
+	} else {
+		password = options.PasswordGenerator()
+	}
+
+	var expiredAt *time.Time
+	if options.TTL != 0 {
+		v := now.Add(options.TTL)
+
+		expiredAt = &v
+	}
+
+	if err := librarian.ValidateLabels(options.Labels); err != nil {
+		return nil, errors.Wrap(err, "cannot clone DB")
+	}
+
+	if err := p.checkLifetime(now, expiredAt); err != nil {
+		return nil, errors.Wrap(err, "cannot clone DB")
+	}
+
+	if err := terminateConnections(ctx, p.rootDB, source.Name); err != nil {
+		return nil, errors.Wrap(err, "cannot terminate connections to source DB")
+	}
+
+	setup := func(ctx context.Context, db *librarian.DB) error {
+		if len(source.Users) == 0 {
+			return nil
+		}
+
+		// NOTE: users of the source DB can't be dropped while they have
+		// privileges in the copy.
+		return p.inDatabase(ctx, db.Database, func(tx *sql.Tx) error {
+			return detachUsers(ctx, tx, source.Name, source.Users, db.Username)
+		})
+	}
+
+	db := &librarian.DB{
+		Database:  database,
+		Owner:     options.Owner,
+		Labels:    options.Labels,
+		Username:  username,
+		Password:  password,
+		CreatedAt: now,
+		ExpiredAt: expiredAt,
+	}
+
+	db, err = p.create(ctx, db, source.Name, setup)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot clone DB")
+	}
+
+	return db, nil
+}
+
+// detachUsers makes the user the owner of objects of users of the source DB
+// and revokes their privileges. Tx must be opened in the copy.
+//
+// REASSIGN OWNED and DROP OWNED affect shared objects too, so the owner of the
+// source database and privileges of its users on it are restored.
+func detachUsers(ctx context.Context, tx *sql.Tx, source string, users []user, to string) error {
+	var owner string
+
+	row := tx.QueryRowContext(ctx, `
+		SELECT pg_get_userbyid(datdba)
+		FROM pg_database
+		WHERE datname = $1
+	`, source)
+	if err := row.Scan(&owner); err != nil {
+		return errors.Wrap(err, "cannot select owner of source database")
+	}
+
+	usernames := make([]string, 0, len(users))
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+
+	if err := revokeAll(ctx, tx, usernames, to); err != nil {
+		return err
+	}
+
+	if err := alterDatabaseOwner(ctx, tx, source, owner); err != nil {
+		return errors.Wrap(err, "cannot restore owner of source database")
+	}
+
+	for _, u := range users {
+		query := fmt.Sprintf(
+			`GRANT %s ON DATABASE %s TO %s`,
+			rolePrivileges[u.Role].Database, pq.QuoteIdentifier(source), pq.QuoteIdentifier(u.Username),
+		)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return errors.Wrap(err, "cannot restore privileges on source database")
+		}
+	}
+
+	return nil
+}
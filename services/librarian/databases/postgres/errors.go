@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	uniqueViolationCode    = "23505"
+	duplicateDatabaseCode  = "42P04"
+	duplicateObjectCode    = "42710"
+	objectInUseCode        = "55006"
+	invalidCatalogNameCode = "3D000"
+
+	insufficientResourcesClass = "53"
+)
+
+// categorize wraps Postgres errors with librarian error categories, so users
+// can tell them apart. Other errors are returned as is.
+func categorize(err error) error {
+	e, ok := errors.Cause(err).(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	switch {
+	case e.Code == uniqueViolationCode, e.Code == duplicateDatabaseCode, e.Code == duplicateObjectCode, e.Code == objectInUseCode:
+		return errors.Wrap(librarian.ErrConflict, e.Message)
+	case e.Code == invalidCatalogNameCode:
+		return errors.Wrap(librarian.ErrNotFound, e.Message)
+	case e.Code.Class() == insufficientResourcesClass:
+		return errors.Wrap(librarian.ErrCapacity, e.Message)
+	}
+
+	return err
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/pkg/starling"
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// Hook is called after a DB was created. Tx is opened in the new database as
+// the new user. If a hook fails, the transaction is rolled back and the whole
+// DB is deleted.
+type Hook func(ctx context.Context, tx *sql.Tx, db *librarian.DB) error
+
+// Seed is a named SQL script, e.g. with fixtures.
+type Seed struct {
+	Name string
+	SQL  string
+}
+
+// WithPostCreateHooks adds hooks which are called in order after create.
+func WithPostCreateHooks(hooks ...Hook) Option {
+	return func(o *Postgres) { o.postCreateHooks = append(o.postCreateHooks, hooks...) }
+}
+
+// WithSeeds executes seed scripts in order after create.
+func WithSeeds(seeds ...Seed) Option {
+	return WithPostCreateHooks(SeedHook(seeds...))
+}
+
+// SeedHook returns the hook which executes seed scripts in order.
+func SeedHook(seeds ...Seed) Hook {
+	return func(ctx context.Context, tx *sql.Tx, db *librarian.DB) error {
+		for _, seed := range seeds {
+			if _, err := tx.ExecContext(ctx, seed.SQL); err != nil {
+				return errors.Wrapf(err, "cannot execute seed %s", seed.Name)
+			}
+		}
+
+		return nil
+	}
+}
+
+// runPostCreateHooks calls hooks in one transaction in the new database.
+func (p *Postgres) runPostCreateHooks(ctx context.Context, db *librarian.DB) error {
+	conn, err := connect(ctx, &connectOptions{
+		Scheme:   p.scheme,
+		Host:     p.host,
+		Port:     p.port,
+		Database: db.Database,
+		Username: db.Username,
+		Password: db.Password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to new database")
+	}
+	defer conn.Close() // nolint:errcheck,gosec
+
+	err = starling.Transaction(ctx, conn, func(tx *sql.Tx) error {
+		for _, hook := range p.postCreateHooks {
+			if err := hook(ctx, tx, db); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "post create hook failed")
+	}
+
+	return nil
+}
+
+// undoCreate drops the database and the user of a failed create and deletes
+// them from management tables. Username is empty if the user wasn't created.
+func (p *Postgres) undoCreate(dbID int, database, username string) error {
+	// NOTE: ctx of create can be already done, but we have to clean up.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := dropDatabase(ctx, p.rootDB, database); err != nil {
+		return errors.Wrap(err, "cannot drop database")
+	}
+
+	if username != "" {
+		if err := dropUser(ctx, p.rootDB, username); err != nil {
+			return errors.Wrap(err, "cannot drop user")
+		}
+	}
+
+	return starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM users
+			WHERE database_id = $1
+		`, dbID)
+		if err != nil {
+			return errors.Wrap(err, "cannot delete users from users")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM databases
+			WHERE id = $1
+		`, dbID)
+		if err != nil {
+			return errors.Wrap(err, "cannot delete database from databases")
+		}
+
+		return nil
+	})
+}
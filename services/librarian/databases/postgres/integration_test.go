@@ -0,0 +1,403 @@
+//go:build integration
+// +build integration
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// Integration tests run against Postgres from docker-compose.yml:
+//
+//   docker-compose -f services/librarian/docker-compose.yml up -d
+//   go test -tags integration ./services/librarian/databases/postgres/
+//
+// POSTGRES_HOST, POSTGRES_PORT, POSTGRES_USER and POSTGRES_PASSWORD override
+// the defaults.
+
+// newIntegrationPostgres returns connected and inited Postgres, disconnect it
+// with the returned function.
+func newIntegrationPostgres(t *testing.T) (*Postgres, func()) {
+	t.Helper()
+
+	opts := []Option{
+		WithHost(getenv("POSTGRES_HOST", "localhost")),
+		WithUsername(getenv("POSTGRES_USER", "postgres")),
+		WithPassword(getenv("POSTGRES_PASSWORD", "")),
+		WithManagementDatabase("librarian_integration"),
+	}
+	if s := os.Getenv("POSTGRES_PORT"); s != "" {
+		port, err := strconv.Atoi(s)
+		if err != nil {
+			t.Fatalf("invalid POSTGRES_PORT: %v", err)
+		}
+
+		opts = append(opts, WithPort(port))
+	}
+
+	p := New(opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := p.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	if err := p.Init(ctx); err != nil {
+		p.Disconnect() // nolint:errcheck,gosec
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	return p, func() { p.Disconnect() } // nolint:errcheck,gosec
+}
+
+func getenv(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return value
+}
+
+// createDB creates a DB, delete it with the returned function.
+func createDB(t *testing.T, p *Postgres, opts ...librarian.CreaterOption) (*librarian.DB, func()) {
+	t.Helper()
+
+	db, err := p.Create(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	return db, func() { p.Delete(context.Background(), db.Database) } // nolint:errcheck,gosec
+}
+
+// connectAs connects to the database as the user.
+func connectAs(t *testing.T, p *Postgres, database, username, password string) (*sql.DB, error) {
+	t.Helper()
+
+	return connect(context.Background(), &connectOptions{
+		Scheme:   p.scheme,
+		Host:     p.host,
+		Port:     p.port,
+		Database: database,
+		Username: username,
+		Password: password,
+	})
+}
+
+func TestIntegrationMigrationsAreOwnedByUser(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	db, deleteDB := createDB(t, p, librarian.WithMigrations(librarian.Migration{
+		Name: "create items",
+		SQL:  `CREATE TABLE items (id INT); CREATE SEQUENCE items_seq;`,
+	}))
+	defer deleteDB()
+
+	conn, err := connectAs(t, p, db.Database, db.Username, db.Password)
+	if err != nil {
+		t.Fatalf("cannot connect as user: %v", err)
+	}
+	defer conn.Close() // nolint:errcheck
+
+	for _, query := range []string{
+		`ALTER TABLE items ADD COLUMN name TEXT`,
+		`DROP TABLE items`,
+		`DROP SEQUENCE items_seq`,
+	} {
+		if _, err := conn.Exec(query); err != nil {
+			t.Errorf("%s: %v", query, err)
+		}
+	}
+}
+
+func TestIntegrationMigrationsAreNotPrivileged(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	_, err := p.Create(context.Background(), librarian.WithMigrations(librarian.Migration{
+		Name: "create superuser",
+		SQL:  `CREATE ROLE librarian_integration_evil SUPERUSER LOGIN`,
+	}))
+	if errors.Cause(err) != librarian.ErrInvalidInput {
+		t.Errorf("Create() error = %v, want %v", err, librarian.ErrInvalidInput)
+	}
+}
+
+// insufficientPrivilegeCode is returned when a user can't connect to a
+// database without CONNECT privilege.
+const insufficientPrivilegeCode = "42501"
+
+func TestIntegrationUsersAreIsolated(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	a, deleteA := createDB(t, p)
+	defer deleteA()
+
+	b, deleteB := createDB(t, p)
+	defer deleteB()
+
+	for _, database := range []string{b.Database, p.managementDatabase} {
+		conn, err := connectAs(t, p, database, a.Username, a.Password)
+		if err == nil {
+			conn.Close() // nolint:errcheck,gosec
+			t.Errorf("user of DB %s can connect to %s", a.Database, database)
+			continue
+		}
+
+		if e, ok := errors.Cause(err).(*pq.Error); !ok || e.Code != insufficientPrivilegeCode {
+			t.Errorf("connect to %s: error = %v, want permission denied", database, err)
+		}
+	}
+
+	// The owner still can connect to its own DB
+	conn, err := connectAs(t, p, a.Database, a.Username, a.Password)
+	if err != nil {
+		t.Fatalf("cannot connect to own DB: %v", err)
+	}
+	conn.Close() // nolint:errcheck,gosec
+}
+
+func TestIntegrationLockQuota(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	ctx := context.Background()
+
+	unlock, err := p.LockQuota(ctx, "integration")
+	if err != nil {
+		t.Fatalf("LockQuota() error = %v", err)
+	}
+
+	// The quota of another tenant isn't locked
+	unlockOther, err := p.LockQuota(ctx, "integration-other")
+	if err != nil {
+		t.Fatalf("LockQuota() of another tenant error = %v", err)
+	}
+	unlockOther()
+
+	// The locked quota waits
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if unlockAgain, err := p.LockQuota(waitCtx, "integration"); err == nil {
+		unlockAgain()
+		t.Fatal("LockQuota() of a locked quota didn't wait")
+	}
+
+	unlock()
+
+	unlock, err = p.LockQuota(ctx, "integration")
+	if err != nil {
+		t.Fatalf("LockQuota() after unlock error = %v", err)
+	}
+	unlock()
+}
+
+func TestIntegrationUsage(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	owner := "integration-" + librarian.GenerateDBName()
+
+	_, deleteDB := createDB(t, p, librarian.WithOwner(owner), librarian.WithTTL(time.Hour))
+	defer deleteDB()
+
+	usage, err := p.Usage(context.Background(), owner)
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+
+	if usage.Databases != 1 {
+		t.Errorf("usage of %d DBs, want 1", usage.Databases)
+	}
+	if usage.DBTime.Round(time.Minute) != time.Hour {
+		t.Errorf("usage of %s, want 1h", usage.DBTime)
+	}
+}
+
+func TestIntegrationListByLabels(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	// NOTE: the owner keeps DBs of other tests out of the list.
+	owner := "integration-" + librarian.GenerateDBName()
+
+	master, deleteMaster := createDB(t, p, librarian.WithOwner(owner), librarian.WithLabels(map[string]string{"repo": "shards", "branch": "master"}))
+	defer deleteMaster()
+
+	dev, deleteDev := createDB(t, p, librarian.WithOwner(owner), librarian.WithLabels(map[string]string{"repo": "shards", "branch": "dev"}))
+	defer deleteDev()
+
+	unlabeled, deleteUnlabeled := createDB(t, p, librarian.WithOwner(owner))
+	defer deleteUnlabeled()
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{selector: "", want: []string{master.Database, dev.Database, unlabeled.Database}},
+		{selector: "repo=shards", want: []string{master.Database, dev.Database}},
+		{selector: "repo=shards,branch!=master", want: []string{dev.Database}},
+		{selector: "branch!=master", want: []string{dev.Database, unlabeled.Database}},
+		{selector: "repo=librarian", want: nil},
+	}
+
+	for _, tt := range tests {
+		selector, err := librarian.ParseSelector(tt.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dbs, err := p.List(context.Background(), librarian.WithOwnedBy(owner), librarian.WithSelector(selector))
+		if err != nil {
+			t.Fatalf("%q: List() error = %v", tt.selector, err)
+		}
+
+		got := make(map[string]bool, len(dbs))
+		for _, db := range dbs {
+			got[db.Database] = true
+		}
+
+		want := make(map[string]bool, len(tt.want))
+		for _, name := range tt.want {
+			want[name] = true
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: List() = %v, want %v", tt.selector, got, want)
+		}
+	}
+}
+
+// dropRole drops the user behind the librarian, e.g. like an operator does.
+func dropRole(t *testing.T, p *Postgres, database, username, owner string) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	err := p.inDatabase(ctx, database, func(tx *sql.Tx) error {
+		return revokeAll(ctx, tx, []string{username}, owner)
+	})
+	if err != nil {
+		t.Fatalf("cannot revoke privileges of %s: %v", username, err)
+	}
+
+	if err := dropUser(ctx, p.rootDB, username); err != nil {
+		t.Fatalf("cannot drop %s: %v", username, err)
+	}
+}
+
+// hasUser returns true if the user of the DB isn't deleted.
+func hasUser(t *testing.T, p *Postgres, database, username string) bool {
+	t.Helper()
+
+	d, err := p.get(context.Background(), p.managementDB, database, false)
+	if err != nil {
+		t.Fatalf("cannot get DB %s: %v", database, err)
+	}
+
+	for _, u := range d.Users {
+		if u.Username == username {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestIntegrationDeleteExpiredUsersWithoutRole(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	ctx := context.Background()
+
+	db, deleteDB := createDB(t, p)
+	defer deleteDB()
+
+	dropped, err := p.CreateUser(ctx, db.Database, librarian.WithUserTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	kept, err := p.CreateUser(ctx, db.Database, librarian.WithUserTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	dropRole(t, p, db.Database, dropped.Username, db.Username)
+
+	defer func() { nowFunc = time.Now }()
+	nowFunc = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+	deleted, err := p.DeleteExpiredUsers(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpiredUsers() error = %v", err)
+	}
+
+	var usernames []string
+	for _, d := range deleted {
+		if d.Database != db.Database {
+			continue
+		}
+
+		for _, u := range d.Users {
+			usernames = append(usernames, u.Username)
+		}
+	}
+	if len(usernames) != 2 {
+		t.Errorf("deleted users = %v, want %s and %s", usernames, dropped.Username, kept.Username)
+	}
+
+	for _, username := range []string{dropped.Username, kept.Username} {
+		if hasUser(t, p, db.Database, username) {
+			t.Errorf("user %s wasn't reaped", username)
+		}
+	}
+
+	if exists, err := userExists(ctx, p.rootDB, kept.Username); err != nil || exists {
+		t.Errorf("role %s exists = %t, %v, want dropped", kept.Username, exists, err)
+	}
+}
+
+func TestIntegrationDeleteUserWithoutRole(t *testing.T) {
+	p, disconnect := newIntegrationPostgres(t)
+	defer disconnect()
+
+	ctx := context.Background()
+
+	db, deleteDB := createDB(t, p)
+	defer deleteDB()
+
+	u, err := p.CreateUser(ctx, db.Database)
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	dropRole(t, p, db.Database, u.Username, db.Username)
+
+	if err := p.DeleteUser(ctx, db.Database, u.Username); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if hasUser(t, p, db.Database, u.Username) {
+		t.Errorf("user %s wasn't deleted", u.Username)
+	}
+
+	// Deleted users are gone
+	if err := p.DeleteUser(ctx, db.Database, u.Username); errors.Cause(err) != librarian.ErrNotFound {
+		t.Errorf("DeleteUser() again error = %v, want %v", err, librarian.ErrNotFound)
+	}
+}
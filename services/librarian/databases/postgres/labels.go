@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// selectLabels is the column with labels of the database d as a JSON object,
+// it's NULL if the database has no labels.
+const selectLabels = `(SELECT json_object_agg(l.key, l.value) FROM labels AS l WHERE l.database_id = d.id)`
+
+// setLabels replaces labels of the database.
+func setLabels(ctx context.Context, tx *sql.Tx, databaseID int, labels map[string]string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM labels
+		WHERE database_id = $1
+	`, databaseID)
+	if err != nil {
+		return errors.Wrap(err, "cannot delete labels")
+	}
+
+	for key, value := range labels {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO labels (database_id, key, value)
+			VALUES ($1, $2, $3)
+		`, databaseID, key, value)
+		if err != nil {
+			return errors.Wrapf(err, "cannot insert label %s", key)
+		}
+	}
+
+	return nil
+}
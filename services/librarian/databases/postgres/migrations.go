@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/pkg/starling"
+)
+
+// migrationsLockKey is the advisory lock key which is held while the
+// management database is migrated, so instances don't migrate it at once.
+const migrationsLockKey = 7011943117
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations of the management database in order. Applied migrations must
+// never be changed, add a new one instead.
+//
+// NOTE: the first migrations use "IF NOT EXISTS", because the tables could be
+// created before migrations were introduced.
+// nolint:gochecknoglobals
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create databases and users",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS databases (
+				id SERIAL,
+				name VARCHAR(255) NOT NULL,
+				expired_at TIMESTAMP WITH TIME ZONE,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				deleted_at TIMESTAMP WITH TIME ZONE,
+
+				CONSTRAINT pk__databases__id PRIMARY KEY (id),
+				CONSTRAINT ux__databases__name UNIQUE (name)
+			);
+
+			CREATE TABLE IF NOT EXISTS users (
+				id SERIAL,
+				username VARCHAR(255) NOT NULL,
+				database_id INT NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				deleted_at TIMESTAMP WITH TIME ZONE,
+
+				CONSTRAINT pk__users__id PRIMARY KEY (id),
+				CONSTRAINT ux__users__name UNIQUE (username),
+				CONSTRAINT fk__users__database_id FOREIGN KEY (database_id) REFERENCES databases(id)
+			);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "create templates",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS templates (
+				id SERIAL,
+				hash VARCHAR(64) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				used_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+				CONSTRAINT pk__templates__id PRIMARY KEY (id),
+				CONSTRAINT ux__templates__hash UNIQUE (hash),
+				CONSTRAINT ux__templates__name UNIQUE (name)
+			);
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "add role to users",
+		SQL: `
+			-- Users were created with all privileges before roles
+			ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'owner';
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "add expiration time to users",
+		SQL: `
+			ALTER TABLE users ADD COLUMN expired_at TIMESTAMP WITH TIME ZONE;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add owners and tokens",
+		SQL: `
+			ALTER TABLE databases ADD COLUMN owner VARCHAR(255);
+
+			CREATE INDEX ix__databases__owner ON databases (owner);
+
+			CREATE TABLE tokens (
+				id SERIAL,
+				hash VARCHAR(64) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				tenant VARCHAR(255) NOT NULL,
+				admin BOOLEAN NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				revoked_at TIMESTAMP WITH TIME ZONE,
+
+				CONSTRAINT pk__tokens__id PRIMARY KEY (id),
+				CONSTRAINT ux__tokens__hash UNIQUE (hash)
+			);
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "create labels",
+		SQL: `
+			CREATE TABLE labels (
+				database_id INT NOT NULL,
+				key VARCHAR(63) NOT NULL,
+				value VARCHAR(255) NOT NULL,
+
+				CONSTRAINT pk__labels__database_id__key PRIMARY KEY (database_id, key),
+				CONSTRAINT fk__labels__database_id FOREIGN KEY (database_id) REFERENCES databases(id) ON DELETE CASCADE
+			);
+
+			CREATE INDEX ix__labels__key__value ON labels (key, value);
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "create placements",
+		SQL: `
+			CREATE TABLE placements (
+				name VARCHAR(255) NOT NULL,
+				shard VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+				CONSTRAINT pk__placements__name PRIMARY KEY (name)
+			);
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add role to templates",
+		SQL: `
+			-- Templates without a role were built by the root user
+			ALTER TABLE templates ADD COLUMN role VARCHAR(63);
+		`,
+	},
+}
+
+// migrate applies new migrations to the management database in one
+// transaction.
+func (p *Postgres) migrate(ctx context.Context) error {
+	return starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockKey); err != nil {
+			return errors.Wrap(err, "cannot lock migrations")
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INT NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				applied_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+				CONSTRAINT pk__schema_migrations__version PRIMARY KEY (version)
+			)
+		`)
+		if err != nil {
+			return errors.Wrap(err, `cannot create "schema_migrations" table`)
+		}
+
+		var version int
+		row := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+		if err := row.Scan(&version); err != nil {
+			return errors.Wrap(err, "cannot select schema version")
+		}
+
+		for _, m := range migrations {
+			if m.Version <= version {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+				return errors.Wrapf(err, "cannot apply migration %d %q", m.Version, m.Name)
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO schema_migrations (version, name, applied_at)
+				VALUES ($1, $2, $3)
+			`, m.Version, m.Name, nowFunc())
+			if err != nil {
+				return errors.Wrapf(err, "cannot insert migration %d", m.Version)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// sortKey is an expression of the databases table "d" which lists are sorted
+// by.
+type sortKey struct {
+	expr string
+	// cast is appended to placeholders of values, e.g. "::TEXT"
+	cast string
+	desc bool
+	// value returns the value of the key at the cursor
+	value func(c *librarian.Cursor) interface{}
+}
+
+// sortKeys converts orders to keys. Names are the last key, so the order is
+// stable. They are compared bytewise like librarian.Less does.
+func sortKeys(orders []librarian.Order) ([]sortKey, error) {
+	if len(orders) == 0 {
+		orders = librarian.DefaultSort
+	}
+
+	keys := make([]sortKey, 0, len(orders)+1)
+	for _, o := range orders {
+		switch o.Field {
+		case librarian.SortCreatedAt:
+			keys = append(keys, sortKey{
+				expr:  `d.created_at`,
+				cast:  `::TIMESTAMP WITH TIME ZONE`,
+				desc:  o.Desc,
+				value: func(c *librarian.Cursor) interface{} { return c.CreatedAt },
+			})
+		case librarian.SortExpiredAt:
+			// NOTE: DBs without TTL never expire, so they go after others.
+			keys = append(keys, sortKey{
+				expr: `COALESCE(d.expired_at, 'infinity')`,
+				cast: `::TIMESTAMP WITH TIME ZONE`,
+				desc: o.Desc,
+				value: func(c *librarian.Cursor) interface{} {
+					if c.ExpiredAt == nil {
+						return "infinity"
+					}
+
+					return *c.ExpiredAt
+				},
+			})
+		default:
+			return nil, errors.Wrapf(librarian.ErrInvalidInput, "unknown sort field %q", o.Field)
+		}
+	}
+
+	keys = append(keys, sortKey{
+		expr:  `d.name COLLATE "C"`,
+		cast:  ``,
+		desc:  false,
+		value: func(c *librarian.Cursor) interface{} { return c.Database },
+	})
+
+	return keys, nil
+}
+
+// keyset returns the condition which matches databases after the cursor, e.g.
+// "(a > $1) OR (a = $1 AND b < $2)" for "a, b DESC".
+func keyset(keys []sortKey, cursor *librarian.Cursor, arg func(v interface{}) string) string {
+	placeholders := make([]string, 0, len(keys))
+	for _, k := range keys {
+		placeholders = append(placeholders, arg(k.value(cursor))+k.cast)
+	}
+
+	conditions := make([]string, 0, len(keys))
+	for i, k := range keys {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].expr+` = `+placeholders[j])
+		}
+
+		op := ` > `
+		if k.desc {
+			op = ` < `
+		}
+		parts = append(parts, k.expr+op+placeholders[i])
+
+		conditions = append(conditions, `(`+strings.Join(parts, ` AND `)+`)`)
+	}
+
+	return strings.Join(conditions, ` OR `)
+}
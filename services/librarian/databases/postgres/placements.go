@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// PlaceDB records the shard of the DB in the management database, so it can
+// serve as the catalog of a sharded backend. It returns librarian.ErrConflict
+// if the DB is already placed.
+func (p *Postgres) PlaceDB(ctx context.Context, id, shard string) error {
+	_, err := p.managementDB.ExecContext(ctx, `
+		INSERT INTO placements (name, shard, created_at)
+		VALUES ($1, $2, $3)
+	`, id, shard, nowFunc())
+	if err != nil {
+		return errors.Wrap(categorize(err), "cannot insert placement")
+	}
+
+	return nil
+}
+
+// ShardOf returns the shard of the DB or librarian.ErrNotFound if the DB isn't
+// placed.
+func (p *Postgres) ShardOf(ctx context.Context, id string) (string, error) {
+	var shard string
+
+	row := p.managementDB.QueryRowContext(ctx, `
+		SELECT shard
+		FROM placements
+		WHERE name = $1
+	`, id)
+
+	err := row.Scan(&shard)
+	if err == sql.ErrNoRows {
+		return "", errors.Wrapf(librarian.ErrNotFound, "DB %s isn't placed", id)
+	}
+	if err != nil {
+		return "", errors.Wrap(categorize(err), "cannot select placement")
+	}
+
+	return shard, nil
+}
+
+// UnplaceDB deletes the placement of the DB, it's a no-op if the DB isn't
+// placed.
+func (p *Postgres) UnplaceDB(ctx context.Context, id string) error {
+	_, err := p.managementDB.ExecContext(ctx, `
+		DELETE FROM placements
+		WHERE name = $1
+	`, id)
+	if err != nil {
+		return errors.Wrap(categorize(err), "cannot delete placement")
+	}
+
+	return nil
+}
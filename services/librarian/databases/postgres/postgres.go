@@ -3,6 +3,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -47,6 +50,28 @@ func WithSoftDelete() Option {
 	return func(o *Postgres) { o.softDelete = true }
 }
 
+// WithTemplates allows users to create DBs from the given template databases.
+// Other databases can't be cloned.
+func WithTemplates(templates ...string) Option {
+	return func(o *Postgres) {
+		for _, template := range templates {
+			o.templates[template] = true
+		}
+	}
+}
+
+// WithTemplateTTL sets how long templates built from migrations are kept
+// since they were used last time.
+func WithTemplateTTL(ttl time.Duration) Option {
+	return func(o *Postgres) { o.templateTTL = ttl }
+}
+
+// WithMaxLifetime limits how long a DB can live since its creation, both on
+// create and on renew. Set `0` if without limit.
+func WithMaxLifetime(lifetime time.Duration) Option {
+	return func(o *Postgres) { o.maxLifetime = lifetime }
+}
+
 type Postgres struct {
 	scheme             string
 	host               string
@@ -55,6 +80,13 @@ type Postgres struct {
 	password           string
 	managementDatabase string
 	softDelete         bool
+	maxLifetime        time.Duration
+	templates          map[string]bool
+	templateTTL        time.Duration
+	postCreateHooks    []Hook
+
+	// Detected on Init, see checkPrivileges
+	superuser bool
 
 	rootDB       *sql.DB
 	managementDB *sql.DB
@@ -63,13 +95,19 @@ type Postgres struct {
 type database struct {
 	ID        int
 	Name      string
+	Owner     string
+	Labels    map[string]string
+	CreatedAt time.Time
 	ExpiredAt *time.Time
+	DeletedAt *time.Time
 	Users     []user
 }
 
 type user struct {
-	ID       int
-	Username string
+	ID        int
+	Username  string
+	Role      librarian.Role
+	ExpiredAt *time.Time
 }
 
 func New(opts ...Option) *Postgres {
@@ -81,6 +119,12 @@ func New(opts ...Option) *Postgres {
 		password:           "",
 		managementDatabase: "librarian",
 		softDelete:         false,
+		maxLifetime:        0,
+		templates:          make(map[string]bool),
+		templateTTL:        24 * time.Hour,
+		postCreateHooks:    nil,
+
+		superuser: false,
 
 		rootDB:       nil,
 		managementDB: nil,
@@ -127,10 +171,32 @@ func (p *Postgres) Disconnect() error {
 	return nil
 }
 
+var _ librarian.Pinger = (*Postgres)(nil)
+
+// Ping checks connections to the root and management databases. It fails
+// until Connect and Init are done.
+func (p *Postgres) Ping(ctx context.Context) error {
+	if p.rootDB == nil || p.managementDB == nil {
+		return errors.New("postgres is not initialized")
+	}
+
+	if err := p.rootDB.PingContext(ctx); err != nil {
+		return errors.Wrap(err, "cannot ping root database")
+	}
+
+	if err := p.managementDB.PingContext(ctx); err != nil {
+		return errors.Wrap(err, "cannot ping management database")
+	}
+
+	return nil
+}
+
 func (p *Postgres) Init(ctx context.Context) error {
-	if err := p.createManagementDB(ctx); err != nil {
-		const duplicateDatabaseCode = "42P04"
+	if err := p.checkPrivileges(ctx); err != nil {
+		return errors.Wrap(err, "root user has not enough privileges")
+	}
 
+	if err := p.createManagementDB(ctx); err != nil {
 		if e, ok := errors.Cause(err).(*pq.Error); ok && e.Code == duplicateDatabaseCode {
 			// That's ok
 		} else {
@@ -138,22 +204,19 @@ func (p *Postgres) Init(ctx context.Context) error {
 		}
 	}
 
+	// NOTE: users of DBs must not see the management database.
+	if err := revokePublic(ctx, p.rootDB, p.managementDatabase); err != nil {
+		return errors.Wrap(err, "cannot protect management database")
+	}
+
 	if err := p.connectManagementDB(ctx); err != nil {
 		return errors.Wrap(err, "cannot connect to management DB")
 	}
 
-	if err := p.createManagementTables(ctx); err != nil {
-		const duplicateTableCode = "42P07"
-
-		if e, ok := errors.Cause(err).(*pq.Error); ok && e.Code == duplicateTableCode {
-			// That's ok
-		} else {
-			return errors.Wrap(err, "cannot create management tables")
-		}
+	if err := p.migrate(ctx); err != nil {
+		return errors.Wrap(err, "cannot migrate management database")
 	}
 
-	// TODO: Add migrations
-
 	return nil
 }
 
@@ -179,6 +242,66 @@ func (p *Postgres) Create(ctx context.Context, opts ...librarian.CreaterOption)
 		password = options.PasswordGenerator()
 	}
 
+	var expiredAt *time.Time
+	if options.TTL != 0 {
+		v := now.Add(options.TTL)
+
+		expiredAt = &v
+	}
+
+	if err := librarian.ValidateLabels(options.Labels); err != nil {
+		return nil, errors.Wrap(err, "cannot create DB")
+	}
+
+	if err := p.checkLifetime(now, expiredAt); err != nil {
+		return nil, errors.Wrap(err, "cannot create DB")
+	}
+
+	if options.Template != "" && !p.templates[options.Template] {
+		return nil, errors.Wrapf(librarian.ErrInvalidInput, "template %s is not allowed", options.Template)
+	}
+
+	var setup func(ctx context.Context, db *librarian.DB) error
+	if len(p.postCreateHooks) > 0 {
+		setup = p.runPostCreateHooks
+	}
+
+	template := options.Template
+	if len(options.Migrations) > 0 {
+		if template != "" {
+			return nil, errors.Wrap(librarian.ErrInvalidInput, "template and migrations can't be used together")
+		}
+
+		t, err := p.migrationTemplate(ctx, options.Migrations, now)
+		if err != nil {
+			return nil, errors.Wrap(categorize(err), "cannot get template for migrations")
+		}
+
+		template = t.Name
+		setup = p.adoptTemplate(t.Role, setup)
+	}
+
+	db := &librarian.DB{
+		Database:  database,
+		Owner:     options.Owner,
+		Labels:    options.Labels,
+		Username:  username,
+		Password:  password,
+		CreatedAt: now,
+		ExpiredAt: expiredAt,
+	}
+
+	return p.create(ctx, db, template, setup)
+}
+
+// create creates the DB as a copy of template if it's not empty and its user,
+// then calls setup if it's not nil. Everything is undone if any step fails.
+func (p *Postgres) create(
+	ctx context.Context,
+	db *librarian.DB,
+	template string,
+	setup func(ctx context.Context, db *librarian.DB) error,
+) (*librarian.DB, error) {
 	var (
 		dbID int
 		err  error
@@ -187,16 +310,20 @@ func (p *Postgres) Create(ctx context.Context, opts ...librarian.CreaterOption)
 	// Database
 	err = starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
 		// Insert database
-		id, err := p.insertDatabase(ctx, tx, database, now, options.TTL)
+		id, err := p.insertDatabase(ctx, tx, db)
 		if err != nil {
 			return errors.Wrap(err, "cannot insert database")
 		}
 
+		if err := setLabels(ctx, tx, id, db.Labels); err != nil {
+			return err
+		}
+
 		// NOTE: we do it in transaction because we want to rollback insertions
 		// if we won't create a DB.
 
 		// Create database
-		if err := createDatabase(ctx, p.rootDB, database); err != nil {
+		if err := createDatabase(ctx, p.rootDB, db.Database, template); err != nil {
 			return errors.Wrap(err, "cannot create database")
 		}
 
@@ -205,13 +332,14 @@ func (p *Postgres) Create(ctx context.Context, opts ...librarian.CreaterOption)
 		return nil
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot create DB")
+		return nil, errors.Wrap(categorize(err), "cannot create DB")
 	}
 
 	// User
+	userCreated := false
 	err = starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
 		// Insert user
-		_, err = p.insertUser(ctx, tx, dbID, username, now)
+		_, err = p.insertUser(ctx, tx, dbID, db.Username, librarian.RoleOwner, db.CreatedAt, nil)
 		if err != nil {
 			return errors.Wrap(err, "cannot insert user")
 		}
@@ -219,156 +347,377 @@ func (p *Postgres) Create(ctx context.Context, opts ...librarian.CreaterOption)
 		// NOTE: we do it in transaction because we want to rollback insertions
 		// if we won't create a user.
 
+		// Revoke privileges from public, so users of other DBs can't connect
+		if err := revokePublic(ctx, p.rootDB, db.Database); err != nil {
+			return errors.Wrap(err, "cannot revoke privileges from public")
+		}
+
 		// Create user
-		if err := createUser(ctx, p.rootDB, username, password); err != nil {
+		if err := p.addUser(ctx, db.Username, db.Password, nil); err != nil {
 			return errors.Wrap(err, "cannot create user")
 		}
 
-		// Create user
-		if err := grantAllPrivileges(ctx, p.rootDB, database, username); err != nil {
+		userCreated = true
+
+		// Make user the owner
+		if err := alterDatabaseOwner(ctx, p.rootDB, db.Database, db.Username); err != nil {
+			return errors.Wrap(err, "cannot make user the owner of database")
+		}
+
+		// Grant privileges
+		if err := grantAllPrivileges(ctx, p.rootDB, db.Database, db.Username); err != nil {
 			return errors.Wrap(err, "cannot grand all privileges to user")
 		}
 
 		return nil
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot create user")
+		createdUsername := ""
+		if userCreated {
+			createdUsername = db.Username
+		}
+
+		if uerr := p.undoCreate(dbID, db.Database, createdUsername); uerr != nil {
+			return nil, errors.Wrapf(categorize(err), "cannot create user and undo create: %v", uerr)
+		}
+
+		return nil, errors.Wrap(categorize(err), "cannot create user")
 	}
 
-	var expiredAt *time.Time
-	if options.TTL != 0 {
-		v := now.Add(options.TTL)
+	db.Users = []librarian.User{
+		{Username: db.Username, Password: db.Password, Role: librarian.RoleOwner},
+	}
 
-		expiredAt = &v
+	// Setup
+	if setup != nil {
+		if err := setup(ctx, db); err != nil {
+			if uerr := p.undoCreate(dbID, db.Database, db.Username); uerr != nil {
+				return nil, errors.Wrapf(err, "cannot set up DB and undo create: %v", uerr)
+			}
+
+			return nil, errors.Wrap(err, "cannot set up DB")
+		}
 	}
 
-	return &librarian.DB{
-		Database:  database,
-		Username:  username,
-		Password:  password,
-		ExpiredAt: expiredAt,
-	}, nil
+	return db, nil
+}
+
+func (p *Postgres) Get(ctx context.Context, id string) (*librarian.DB, error) {
+	database, err := p.get(ctx, p.managementDB, id, false)
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot get DB")
+	}
+
+	db := database.toDB()
+
+	return &db, nil
 }
 
-func (p *Postgres) List(ctx context.Context) ([]librarian.DB, error) {
+func (p *Postgres) List(ctx context.Context, opts ...librarian.ListerOption) ([]librarian.DB, error) {
+	options := librarian.NewListerOptions(opts...)
+
 	now := nowFunc()
 
-	databases, err := p.list(ctx, p.managementDB, now, true)
+	databases, err := p.list(ctx, p.managementDB, now, options)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot get list of DBs")
+		return nil, errors.Wrap(categorize(err), "cannot get list of DBs")
 	}
 
 	dbs := make([]librarian.DB, 0, len(databases))
-	for _, db := range databases {
-		for _, user := range db.Users {
-			dbs = append(dbs, librarian.DB{
-				Database:  db.Name,
+	for _, database := range databases {
+		dbs = append(dbs, database.toDB())
+	}
+
+	return dbs, nil
+}
+
+func (p *Postgres) Renew(ctx context.Context, id string, ttl time.Duration) (*librarian.DB, error) {
+	if ttl <= 0 {
+		return nil, errors.Wrap(librarian.ErrInvalidInput, "TTL must be positive")
+	}
+
+	now := nowFunc()
+	expiredAt := now.Add(ttl)
+
+	var renewed *database
+
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		database, err := p.get(ctx, tx, id, true)
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		if database.DeletedAt != nil {
+			return errors.Wrapf(librarian.ErrNotFound, "DB %s is already deleted", id)
+		}
+
+		if database.ExpiredAt != nil && !database.ExpiredAt.After(now) {
+			return errors.Wrapf(librarian.ErrNotFound, "DB %s is already expired", id)
+		}
+
+		if err := p.checkLifetime(database.CreatedAt, &expiredAt); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE databases
+			SET expired_at = $1
+			WHERE id = $2
+		`, expiredAt, database.ID)
+		if err != nil {
+			return errors.Wrap(err, "cannot update expiration time")
+		}
+
+		database.ExpiredAt = &expiredAt
+		renewed = database
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot renew DB")
+	}
+
+	db := renewed.toDB()
+
+	return &db, nil
+}
+
+// Assign sets the owner and labels of an active DB.
+func (p *Postgres) Assign(ctx context.Context, id string, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	options := librarian.NewCreaterOptions(opts...)
+
+	if err := librarian.ValidateLabels(options.Labels); err != nil {
+		return nil, errors.Wrap(err, "cannot assign DB")
+	}
+
+	now := nowFunc()
+
+	var assigned *database
+
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		database, err := p.get(ctx, tx, id, true)
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		db := database.toDB()
+		if status := db.Status(now); status != librarian.StatusActive {
+			return errors.Wrapf(librarian.ErrNotFound, "DB %s is already %s", id, status)
+		}
+
+		var owner *string
+		if options.Owner != "" {
+			owner = &options.Owner
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE databases
+			SET owner = $1
+			WHERE id = $2
+		`, owner, database.ID)
+		if err != nil {
+			return errors.Wrap(err, "cannot update owner")
+		}
+
+		if err := setLabels(ctx, tx, database.ID, options.Labels); err != nil {
+			return err
+		}
+
+		database.Owner = options.Owner
+		database.Labels = options.Labels
+		assigned = database
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot assign DB")
+	}
+
+	db := assigned.toDB()
+
+	return &db, nil
+}
+
+// DeleteExpired drops expired DBs one by one, each one is committed
+// separately, so a DB which can't be dropped doesn't block the others. DBs
+// which were deleted are returned along with the first error.
+func (p *Postgres) DeleteExpired(ctx context.Context) ([]librarian.DB, error) {
+	now := nowFunc()
+
+	databases, err := p.list(ctx, p.managementDB, now, librarian.NewListerOptions(librarian.WithStatus(librarian.StatusExpired)))
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot get list of expired DBs")
+	}
+
+	var (
+		deletedDBs []librarian.DB
+		firstErr   error
+		failed     int
+	)
+	for _, database := range databases {
+		d, err := p.deleteExpired(ctx, database.Name, now)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(categorize(err), "cannot delete expired DB %s", database.Name)
+			}
+			failed++
+			continue
+		}
+		if d == nil {
+			continue
+		}
+
+		for _, user := range d.Users {
+			deletedDBs = append(deletedDBs, librarian.DB{
+				Database:  d.Name,
 				Username:  user.Username,
 				Password:  "",
-				ExpiredAt: db.ExpiredAt,
+				ExpiredAt: d.ExpiredAt,
 			})
 		}
 	}
+	if firstErr != nil {
+		return deletedDBs, errors.Wrapf(firstErr, "%d of %d expired DBs weren't deleted", failed, len(databases))
+	}
 
-	return dbs, nil
+	if err := p.deleteUnusedTemplates(ctx, now); err != nil {
+		return deletedDBs, errors.Wrap(err, "cannot delete unused templates")
+	}
+
+	return deletedDBs, nil
 }
 
-func (p *Postgres) DeleteExpired(ctx context.Context) ([]librarian.DB, error) {
-	now := nowFunc()
+// deleteExpired drops the DB in its own transaction if it's still expired. It
+// returns nil if the DB was renewed or deleted in the meantime.
+func (p *Postgres) deleteExpired(ctx context.Context, name string, now time.Time) (*database, error) {
+	var deleted *database
 
-	var deletedDBs []librarian.DB
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		d, err := p.get(ctx, tx, name, true)
+		if errors.Cause(err) == librarian.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		if d.DeletedAt != nil || d.ExpiredAt == nil || d.ExpiredAt.After(now) {
+			return nil
+		}
+
+		if err := p.drop(ctx, tx, []database{*d}, now); err != nil {
+			return errors.Wrap(err, "cannot drop DB")
+		}
+
+		deleted = d
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+func (p *Postgres) Delete(ctx context.Context, id string) error {
+	now := nowFunc()
 
 	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
-		databases, err := p.list(ctx, p.managementDB, now, true)
+		d, err := p.get(ctx, tx, id, true)
 		if err != nil {
-			return errors.Wrap(err, "cannot get list of expired DBs")
+			return errors.Wrap(err, "cannot get DB")
 		}
 
-		// Drop databases
-		for _, database := range databases {
-			if err := dropDatabase(ctx, p.rootDB, database.Name); err != nil {
-				return errors.Wrap(err, "cannot drop database")
-			}
+		if d.DeletedAt != nil {
+			return errors.Wrapf(librarian.ErrNotFound, "DB %s is already deleted", id)
 		}
 
-		// Drop users
-		for _, database := range databases {
-			for _, user := range database.Users {
-				if err := dropUser(ctx, p.rootDB, user.Username); err != nil {
-					return errors.Wrap(err, "cannot drop user")
-				}
-			}
+		if err := p.drop(ctx, tx, []database{*d}, now); err != nil {
+			return errors.Wrap(err, "cannot drop DB")
 		}
 
-		// Delete users
-		for _, database := range databases {
-			for _, user := range database.Users {
-				if p.softDelete {
-					_, err = tx.ExecContext(ctx, `
-						UPDATE users
-						SET deleted_at = $1
-						WHERE id = $2
-					`, now, user.ID)
-					if err != nil {
-						return errors.Wrap(err, "cannot delete user from users")
-					}
-				} else {
-					_, err = tx.ExecContext(ctx, `
-						DELETE FROM users
-						WHERE id = $1
-					`, user.ID)
-					if err != nil {
-						return errors.Wrap(err, "cannot delete user from users")
-					}
-				}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(categorize(err), "cannot delete DB")
+	}
+
+	return nil
+}
+
+// drop drops databases with their users and deletes them from management
+// tables (softly if it's enabled).
+func (p *Postgres) drop(ctx context.Context, tx *sql.Tx, databases []database, now time.Time) error {
+	var err error
+
+	// Drop databases
+	for _, database := range databases {
+		if err := dropDatabase(ctx, p.rootDB, database.Name); err != nil {
+			return errors.Wrap(err, "cannot drop database")
+		}
+	}
+
+	// Drop users
+	for _, database := range databases {
+		for _, user := range database.Users {
+			if err := dropUser(ctx, p.rootDB, user.Username); err != nil {
+				return errors.Wrap(err, "cannot drop user")
 			}
 		}
+	}
 
-		// Delete databases
-		for _, database := range databases {
+	// Delete users
+	for _, database := range databases {
+		for _, user := range database.Users {
 			if p.softDelete {
 				_, err = tx.ExecContext(ctx, `
-					UPDATE databases
+					UPDATE users
 					SET deleted_at = $1
 					WHERE id = $2
-				`, now, database.ID)
+				`, now, user.ID)
 				if err != nil {
 					return errors.Wrap(err, "cannot delete user from users")
 				}
 			} else {
 				_, err = tx.ExecContext(ctx, `
-					DELETE FROM databases
+					DELETE FROM users
 					WHERE id = $1
-				`, database.ID)
+				`, user.ID)
 				if err != nil {
-					return errors.Wrap(err, "cannot delete database from databases")
+					return errors.Wrap(err, "cannot delete user from users")
 				}
 			}
 		}
+	}
 
-		deletedDBs = make([]librarian.DB, 0, len(databases))
-		for _, db := range databases {
-			for _, user := range db.Users {
-				deletedDBs = append(deletedDBs, librarian.DB{
-					Database:  db.Name,
-					Username:  user.Username,
-					Password:  "",
-					ExpiredAt: db.ExpiredAt,
-				})
+	// Delete databases
+	for _, database := range databases {
+		if p.softDelete {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE databases
+				SET deleted_at = $1
+				WHERE id = $2
+			`, now, database.ID)
+			if err != nil {
+				return errors.Wrap(err, "cannot delete database from databases")
+			}
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				DELETE FROM databases
+				WHERE id = $1
+			`, database.ID)
+			if err != nil {
+				return errors.Wrap(err, "cannot delete database from databases")
 			}
 		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot delete expired DBs")
 	}
 
-	return deletedDBs, nil
+	return nil
 }
 
 func (p *Postgres) createManagementDB(ctx context.Context) error {
-	if err := createDatabase(ctx, p.rootDB, p.managementDatabase); err != nil {
+	if err := createDatabase(ctx, p.rootDB, p.managementDatabase, ""); err != nil {
 		return errors.Wrap(err, "cannot create management database")
 	}
 
@@ -393,55 +742,34 @@ func (p *Postgres) connectManagementDB(ctx context.Context) error {
 	return nil
 }
 
-func (p *Postgres) createManagementTables(ctx context.Context) error {
-	return starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
-		var err error
+func (p *Postgres) checkLifetime(createdAt time.Time, expiredAt *time.Time) error {
+	if p.maxLifetime == 0 {
+		return nil
+	}
 
-		// Create databases table
-		_, err = tx.ExecContext(ctx, `
-			CREATE TABLE databases (
-				id SERIAL,
-				name VARCHAR(255) NOT NULL,
-				expired_at TIMESTAMP WITH TIME ZONE,
-				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
-				deleted_at TIMESTAMP WITH TIME ZONE,
-
-				CONSTRAINT pk__databases__id PRIMARY KEY (id),
-				CONSTRAINT ux__databases__name UNIQUE (name)
-			)
-		`)
-		if err != nil {
-			return errors.Wrap(err, `cannot create "databases" table`)
-		}
+	if expiredAt == nil {
+		return errors.Wrapf(librarian.ErrInvalidInput, "DB without TTL exceeds maximum lifetime %s", p.maxLifetime)
+	}
 
-		// Create users table
-		_, err = tx.ExecContext(ctx, `
-			CREATE TABLE users (
-				id SERIAL,
-				username VARCHAR(255) NOT NULL,
-				database_id INT NOT NULL,
-				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
-				deleted_at TIMESTAMP WITH TIME ZONE,
-
-				CONSTRAINT pk__users__id PRIMARY KEY (id),
-				CONSTRAINT ux__users__name UNIQUE (username),
-				CONSTRAINT fk__users__database_id FOREIGN KEY (database_id) REFERENCES databases(id)
-			)
-		`)
-		if err != nil {
-			return errors.Wrap(err, `cannot create "users" table`)
-		}
+	if expiredAt.Sub(createdAt) > p.maxLifetime {
+		return errors.Wrapf(librarian.ErrInvalidInput, "DB lifetime exceeds maximum lifetime %s", p.maxLifetime)
+	}
 
-		return nil
-	})
+	return nil
 }
 
-func (p *Postgres) insertDatabase(ctx context.Context, db starling.QueryRowContexter, database string, now time.Time, ttl time.Duration) (int, error) {
+func (p *Postgres) insertDatabase(ctx context.Context, db starling.QueryRowContexter, database *librarian.DB) (int, error) {
+	// NOTE: DBs without owner are stored with NULL owner.
+	var owner *string
+	if database.Owner != "" {
+		owner = &database.Owner
+	}
+
 	row := db.QueryRowContext(ctx, `
-		INSERT INTO databases (name, created_at, expired_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO databases (name, owner, created_at, expired_at)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id
-	`, database, now, now.Add(ttl))
+	`, database.Database, owner, database.CreatedAt, database.ExpiredAt)
 
 	var id int
 	if err := row.Scan(&id); err != nil {
@@ -451,12 +779,20 @@ func (p *Postgres) insertDatabase(ctx context.Context, db starling.QueryRowConte
 	return id, nil
 }
 
-func (p *Postgres) insertUser(ctx context.Context, db starling.QueryRowContexter, databaseID int, username string, now time.Time) (int, error) {
+func (p *Postgres) insertUser(
+	ctx context.Context,
+	db starling.QueryRowContexter,
+	databaseID int,
+	username string,
+	role librarian.Role,
+	now time.Time,
+	expiredAt *time.Time,
+) (int, error) {
 	row := db.QueryRowContext(ctx, `
-		INSERT INTO users (username, database_id, created_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO users (username, database_id, role, created_at, expired_at)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
-	`, username, databaseID, now)
+	`, username, databaseID, role, now, expiredAt)
 
 	var id int
 	if err := row.Scan(&id); err != nil {
@@ -466,69 +802,259 @@ func (p *Postgres) insertUser(ctx context.Context, db starling.QueryRowContexter
 	return id, nil
 }
 
-func (p *Postgres) list(ctx context.Context, db starling.QueryContexter, now time.Time, notExired bool) ([]database, error) {
-	var rows *sql.Rows
-	var err error
+// Count returns the number of DBs which match options, sort, cursor and limit
+// are ignored.
+func (p *Postgres) Count(ctx context.Context, opts ...librarian.ListerOption) (int, error) {
+	options := librarian.NewListerOptions(opts...)
 
-	if notExired {
-		rows, err = db.QueryContext(ctx, `
-			SELECT d.id, d.name, d.expired_at, u.id, u.username
-			FROM databases AS d
-			LEFT JOIN users AS u
-			ON u.database_id = d.id
-			WHERE d.deleted_at IS NULL AND d.expired_at IS NOT NULL AND d.expired_at < $1
-		`, now)
-	} else {
-		rows, err = db.QueryContext(ctx, `
-			SELECT d.id, d.name, d.expired_at, u.id, u.username
+	var args queryArgs
+
+	where, err := conditions(options, nowFunc(), args.add)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot count DBs")
+	}
+
+	var count int
+
+	row := p.managementDB.QueryRowContext(ctx, `
+		SELECT count(*)
+		FROM databases AS d
+		WHERE (`+strings.Join(where, `) AND (`)+`)
+	`, args...)
+	if err := row.Scan(&count); err != nil {
+		return 0, errors.Wrap(categorize(err), "cannot count DBs")
+	}
+
+	return count, nil
+}
+
+// list returns databases which match options with their users. Databases are
+// paginated by keyset: the cursor is compared to sort keys, so pages don't
+// shift when databases are added or deleted.
+func (p *Postgres) list(ctx context.Context, db starling.QueryContexter, now time.Time, options *librarian.ListerOptions) ([]database, error) {
+	var args queryArgs
+
+	where, err := conditions(options, now, args.add)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := sortKeys(options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.After != nil {
+		where = append(where, keyset(keys, options.After, args.add))
+	}
+
+	orderBy := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k.desc {
+			orderBy = append(orderBy, k.expr+` DESC`)
+		} else {
+			orderBy = append(orderBy, k.expr+` ASC`)
+		}
+	}
+
+	limit := ``
+	if options.Limit > 0 {
+		limit = `LIMIT ` + args.add(options.Limit)
+	}
+
+	// NOTE: the limit is applied to databases before they are joined with
+	// users.
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.id, d.name, d.owner, `+selectLabels+`, d.created_at, d.expired_at, d.deleted_at, u.id, u.username, u.role, u.expired_at
+		FROM (
+			SELECT *
 			FROM databases AS d
-			LEFT JOIN users AS u
-			ON u.database_id = d.id
-			WHERE d.expired_at < $1
-		`)
+			WHERE (`+strings.Join(where, `) AND (`)+`)
+			ORDER BY `+strings.Join(orderBy, `, `)+`
+			`+limit+`
+		) AS d
+		LEFT JOIN users AS u
+		ON u.database_id = d.id AND (u.deleted_at IS NULL OR d.deleted_at IS NOT NULL)
+		ORDER BY `+strings.Join(orderBy, `, `)+`, u.id
+	`, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot select databases")
 	}
+	defer rows.Close() // nolint:gosec,errcheck
+
+	databases, err := scanDatabases(rows)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot select expired databases")
+		return nil, errors.Wrap(err, "cannot scan databases")
+	}
+
+	return databases, nil
+}
+
+// queryArgs are arguments of a query which is built step by step.
+type queryArgs []interface{}
+
+// add adds the argument and returns its placeholder.
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// conditions returns conditions on databases d which match status, owner and
+// selector of options. There is at least one condition.
+func conditions(options *librarian.ListerOptions, now time.Time, arg func(v interface{}) string) ([]string, error) {
+	var where []string
+
+	switch options.Status {
+	case "":
+	case librarian.StatusActive:
+		where = append(where, `d.deleted_at IS NULL AND (d.expired_at IS NULL OR d.expired_at > `+arg(now)+`)`)
+	case librarian.StatusExpired:
+		where = append(where, `d.deleted_at IS NULL AND d.expired_at IS NOT NULL AND d.expired_at <= `+arg(now))
+	case librarian.StatusDeleted:
+		where = append(where, `d.deleted_at IS NOT NULL`)
+	default:
+		return nil, errors.Wrapf(librarian.ErrInvalidInput, "unknown status %q", options.Status)
+	}
+
+	if options.Owner != "" {
+		where = append(where, `d.owner = `+arg(options.Owner))
+	}
+
+	for _, r := range options.Selector {
+		exists := `EXISTS (SELECT 1 FROM labels AS l WHERE l.database_id = d.id AND l.key = ` + arg(r.Key) + ` AND l.value = ` + arg(r.Value) + `)`
+
+		switch r.Operator {
+		case librarian.OperatorEquals:
+			where = append(where, exists)
+		case librarian.OperatorNotEquals:
+			where = append(where, `NOT `+exists)
+		default:
+			return nil, errors.Wrapf(librarian.ErrInvalidInput, "unknown operator %q", r.Operator)
+		}
+	}
+
+	if len(where) == 0 {
+		where = append(where, `TRUE`)
+	}
+
+	return where, nil
+}
+
+// get returns a database with its users, including softly deleted ones. If
+// forUpdate is true, the database row is locked until the end of the
+// transaction.
+func (p *Postgres) get(ctx context.Context, db starling.QueryContexter, name string, forUpdate bool) (*database, error) {
+	query := `
+		SELECT d.id, d.name, d.owner, ` + selectLabels + `, d.created_at, d.expired_at, d.deleted_at, u.id, u.username, u.role, u.expired_at
+		FROM databases AS d
+		LEFT JOIN users AS u
+		ON u.database_id = d.id AND (u.deleted_at IS NULL OR d.deleted_at IS NOT NULL)
+		WHERE d.name = $1
+		ORDER BY u.id
+	`
+	if forUpdate {
+		query += ` FOR UPDATE OF d`
+	}
+
+	rows, err := db.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot select database")
 	}
 	defer rows.Close() // nolint:gosec,errcheck
 
-	mappedDBs := make(map[int]database)
+	databases, err := scanDatabases(rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot scan database")
+	}
+
+	if len(databases) == 0 {
+		return nil, errors.Wrapf(librarian.ErrNotFound, "DB %s does not exist", name)
+	}
+
+	return &databases[0], nil
+}
+
+// scanDatabases groups rows of databases joined with users by databases
+// keeping order of the rows.
+func scanDatabases(rows *sql.Rows) ([]database, error) {
+	var databases []database
+
+	indexes := make(map[int]int)
 	for rows.Next() {
-		var dtbs struct {
-			ID        int
-			Name      string
-			ExpiredAt *time.Time
-			User      struct {
-				ID       int
-				Username string
-			}
+		var (
+			dtbs      database
+			owner     sql.NullString
+			labels    []byte
+			userID    sql.NullInt64
+			username  sql.NullString
+			role      sql.NullString
+			expiredAt *time.Time
+		)
+
+		if err := rows.Scan(
+			&dtbs.ID, &dtbs.Name, &owner, &labels, &dtbs.CreatedAt, &dtbs.ExpiredAt, &dtbs.DeletedAt,
+			&userID, &username, &role, &expiredAt,
+		); err != nil {
+			return nil, errors.Wrap(err, "cannot scan row")
 		}
 
-		if err := rows.Scan(&dtbs.ID, &dtbs.Name, &dtbs.ExpiredAt, &dtbs.User.ID, &dtbs.User.Username); err != nil {
-			return nil, errors.Wrap(err, "cannot scan database")
+		dtbs.Owner = owner.String
+
+		if labels != nil {
+			if err := json.Unmarshal(labels, &dtbs.Labels); err != nil {
+				return nil, errors.Wrap(err, "cannot unmarshal labels")
+			}
 		}
 
-		d, ok := mappedDBs[dtbs.ID]
+		i, ok := indexes[dtbs.ID]
 		if !ok {
-			d = database{
-				ID:        dtbs.ID,
-				Name:      dtbs.Name,
-				Users:     nil,
-				ExpiredAt: dtbs.ExpiredAt,
-			}
+			i = len(databases)
+			indexes[dtbs.ID] = i
+			databases = append(databases, dtbs)
 		}
 
-		d.Users = append(d.Users, user{
-			ID:       dtbs.User.ID,
-			Username: dtbs.User.Username,
-		})
-		mappedDBs[dtbs.ID] = d
+		if userID.Valid {
+			databases[i].Users = append(databases[i].Users, user{
+				ID:        int(userID.Int64),
+				Username:  username.String,
+				Role:      librarian.Role(role.String),
+				ExpiredAt: expiredAt,
+			})
+		}
 	}
-
-	databases := make([]database, 0, len(mappedDBs))
-	for _, db := range mappedDBs {
-		databases = append(databases, db)
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate over rows")
 	}
 
 	return databases, nil
 }
+
+// toDB converts a database to a DB of its first user.
+func (d *database) toDB() librarian.DB {
+	username := ""
+	if len(d.Users) > 0 {
+		username = d.Users[0].Username
+	}
+
+	users := make([]librarian.User, 0, len(d.Users))
+	for _, u := range d.Users {
+		users = append(users, librarian.User{
+			Username:  u.Username,
+			Password:  "",
+			Role:      u.Role,
+			ExpiredAt: u.ExpiredAt,
+		})
+	}
+
+	return librarian.DB{
+		Database:  d.Name,
+		Owner:     d.Owner,
+		Labels:    d.Labels,
+		Username:  username,
+		Password:  "",
+		Users:     users,
+		CreatedAt: d.CreatedAt,
+		ExpiredAt: d.ExpiredAt,
+		DeletedAt: d.DeletedAt,
+	}
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+func TestConditions(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	selector, err := librarian.ParseSelector("repo=shards,branch!=master")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []librarian.ListerOption
+		want     []string
+		wantArgs queryArgs
+	}{
+		{
+			name:     "all",
+			opts:     nil,
+			want:     []string{`TRUE`},
+			wantArgs: nil,
+		},
+		{
+			name: "active of owner",
+			opts: []librarian.ListerOption{librarian.WithStatus(librarian.StatusActive), librarian.WithOwnedBy("ci")},
+			want: []string{
+				`d.deleted_at IS NULL AND (d.expired_at IS NULL OR d.expired_at > $1)`,
+				`d.owner = $2`,
+			},
+			wantArgs: queryArgs{now, "ci"},
+		},
+		{
+			name: "labels",
+			opts: []librarian.ListerOption{librarian.WithSelector(selector)},
+			want: []string{
+				`EXISTS (SELECT 1 FROM labels AS l WHERE l.database_id = d.id AND l.key = $1 AND l.value = $2)`,
+				`NOT EXISTS (SELECT 1 FROM labels AS l WHERE l.database_id = d.id AND l.key = $3 AND l.value = $4)`,
+			},
+			wantArgs: queryArgs{"repo", "shards", "branch", "master"},
+		},
+		{
+			name: "expired with labels",
+			opts: []librarian.ListerOption{
+				librarian.WithStatus(librarian.StatusExpired),
+				librarian.WithSelector(librarian.Selector{{Key: "repo", Operator: librarian.OperatorEquals, Value: ""}}),
+			},
+			want: []string{
+				`d.deleted_at IS NULL AND d.expired_at IS NOT NULL AND d.expired_at <= $1`,
+				`EXISTS (SELECT 1 FROM labels AS l WHERE l.database_id = d.id AND l.key = $2 AND l.value = $3)`,
+			},
+			wantArgs: queryArgs{now, "repo", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var args queryArgs
+
+			got, err := conditions(librarian.NewListerOptions(tt.opts...), now, args.add)
+			if err != nil {
+				t.Fatalf("conditions() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("conditions() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestConditionsInvalid(t *testing.T) {
+	for name, options := range map[string]*librarian.ListerOptions{
+		"status":   librarian.NewListerOptions(librarian.WithStatus("archived")),
+		"operator": librarian.NewListerOptions(librarian.WithSelector(librarian.Selector{{Key: "repo", Operator: "~", Value: "shards"}})),
+	} {
+		var args queryArgs
+
+		if _, err := conditions(options, time.Now(), args.add); errors.Cause(err) != librarian.ErrInvalidInput {
+			t.Errorf("%s: conditions() error = %v, want %v", name, err, librarian.ErrInvalidInput)
+		}
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	createdAt := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// NOTE: values of cursors come from clients, so they must be arguments.
+	cursor := &librarian.Cursor{Database: "db_1' OR TRUE --", CreatedAt: createdAt, ExpiredAt: nil}
+
+	tests := []struct {
+		name     string
+		orders   []librarian.Order
+		want     string
+		wantArgs queryArgs
+	}{
+		{
+			name:     "createdAt",
+			orders:   nil,
+			want:     `(d.created_at > $1::TIMESTAMP WITH TIME ZONE) OR (d.created_at = $1::TIMESTAMP WITH TIME ZONE AND d.name COLLATE "C" > $2)`,
+			wantArgs: queryArgs{createdAt, cursor.Database},
+		},
+		{
+			name:     "-createdAt",
+			orders:   []librarian.Order{{Field: librarian.SortCreatedAt, Desc: true}},
+			want:     `(d.created_at < $1::TIMESTAMP WITH TIME ZONE) OR (d.created_at = $1::TIMESTAMP WITH TIME ZONE AND d.name COLLATE "C" > $2)`,
+			wantArgs: queryArgs{createdAt, cursor.Database},
+		},
+		{
+			name:   "expiredAt without TTL",
+			orders: []librarian.Order{{Field: librarian.SortExpiredAt, Desc: false}},
+			want: `(COALESCE(d.expired_at, 'infinity') > $1::TIMESTAMP WITH TIME ZONE) OR ` +
+				`(COALESCE(d.expired_at, 'infinity') = $1::TIMESTAMP WITH TIME ZONE AND d.name COLLATE "C" > $2)`,
+			wantArgs: queryArgs{"infinity", cursor.Database},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := sortKeys(tt.orders)
+			if err != nil {
+				t.Fatalf("sortKeys() error = %v", err)
+			}
+
+			var args queryArgs
+
+			if got := keyset(keys, cursor, args.add); got != tt.want {
+				t.Errorf("keyset() = %s, want %s", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
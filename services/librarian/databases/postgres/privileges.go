@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// checkPrivileges checks that the root user can manage DBs: it must be a
+// superuser or have CREATEDB and CREATEROLE attributes.
+//
+// Without superuser, the root user becomes a member of every created user, so
+// it can act as the owner of its database and objects:
+//
+//   - CREATEDB: create, clone and drop DBs, build templates from migrations
+//   - CREATEROLE: create and drop users, grant privileges of roles, terminate
+//     connections of users on clone and on deletion of credentials
+//
+// Templates from WithTemplates must be owned by the root user or be marked as
+// templates (IS_TEMPLATE).
+func (p *Postgres) checkPrivileges(ctx context.Context) error {
+	var superuser, createDB, createRole bool
+
+	row := p.rootDB.QueryRowContext(ctx, `
+		SELECT rolsuper, rolcreatedb, rolcreaterole
+		FROM pg_roles
+		WHERE rolname = current_user
+	`)
+	if err := row.Scan(&superuser, &createDB, &createRole); err != nil {
+		return errors.Wrap(err, "cannot select attributes of root user")
+	}
+
+	if !superuser && (!createDB || !createRole) {
+		return errors.Errorf(
+			"root user %s must be a superuser or have CREATEDB and CREATEROLE attributes (createdb: %t, createrole: %t)",
+			p.username, createDB, createRole,
+		)
+	}
+
+	p.superuser = superuser
+
+	return nil
+}
+
+// addUser creates a user. Without superuser, the root user becomes a member of
+// the user to manage its database and objects.
+func (p *Postgres) addUser(ctx context.Context, username, password string, validUntil *time.Time) error {
+	if err := createUser(ctx, p.rootDB, username, password, validUntil); err != nil {
+		return err
+	}
+
+	if p.superuser {
+		return nil
+	}
+
+	query := fmt.Sprintf(`GRANT %s TO CURRENT_USER`, pq.QuoteIdentifier(username))
+	if _, err := p.rootDB.ExecContext(ctx, query); err != nil {
+		if derr := dropUser(ctx, p.rootDB, username); derr != nil {
+			return errors.Wrapf(err, "cannot grant user to root user and drop user: %v", derr)
+		}
+
+		return errors.Wrap(err, "cannot grant user to root user")
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+var _ librarian.QuotaLocker = (*Postgres)(nil)
+
+// quotaLockClass is the first key of advisory locks which serialize checks of
+// quotas of a tenant.
+const quotaLockClass = 7011
+
+// LockQuota locks the quota of the tenant with an advisory lock in the
+// management database, so it can serialize checks of quotas of all instances
+// of the librarian. The lock is held by a transaction until unlock is called.
+func (p *Postgres) LockQuota(ctx context.Context, tenant string) (func(), error) {
+	tx, err := p.managementDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot begin transaction")
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, quotaLockClass, tenant); err != nil {
+		tx.Rollback() // nolint:errcheck,gosec
+		return nil, errors.Wrap(categorize(err), "cannot lock quota")
+	}
+
+	// NOTE: rollback releases the lock, nothing else was done.
+	return func() { tx.Rollback() }, nil // nolint:errcheck,gosec
+}
+
+// Usage returns the usage of quotas by active DBs of the owner.
+func (p *Postgres) Usage(ctx context.Context, owner string) (librarian.Usage, error) {
+	var (
+		usage   librarian.Usage
+		seconds float64
+	)
+
+	row := p.managementDB.QueryRowContext(ctx, `
+		SELECT count(*), COALESCE(EXTRACT(EPOCH FROM sum(expired_at - $2)), 0)
+		FROM databases
+		WHERE owner = $1 AND deleted_at IS NULL AND (expired_at IS NULL OR expired_at > $2)
+	`, owner, nowFunc())
+	if err := row.Scan(&usage.Databases, &seconds); err != nil {
+		return usage, errors.Wrap(categorize(err), "cannot select usage of quota")
+	}
+
+	usage.DBTime = time.Duration(seconds * float64(time.Second))
+
+	return usage, nil
+}
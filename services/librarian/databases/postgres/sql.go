@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
@@ -11,7 +12,7 @@ import (
 )
 
 func dropDatabase(ctx context.Context, db starling.ExecContexter, name string) error {
-	query := fmt.Sprintf(`DROP DATABASE %s`, pq.QuoteIdentifier(name))
+	query := fmt.Sprintf(`DROP DATABASE IF EXISTS %s`, pq.QuoteIdentifier(name))
 
 	if _, err := db.ExecContext(ctx, query); err != nil {
 		return errors.Wrap(err, "cannot drop database")
@@ -20,8 +21,13 @@ func dropDatabase(ctx context.Context, db starling.ExecContexter, name string) e
 	return nil
 }
 
-func createDatabase(ctx context.Context, db starling.ExecContexter, name string) error {
+// createDatabase creates an empty database or a copy of template if it's not
+// empty.
+func createDatabase(ctx context.Context, db starling.ExecContexter, name, template string) error {
 	query := fmt.Sprintf(`CREATE DATABASE %s`, pq.QuoteIdentifier(name))
+	if template != "" {
+		query += fmt.Sprintf(` TEMPLATE %s`, pq.QuoteIdentifier(template))
+	}
 
 	if _, err := db.ExecContext(ctx, query); err != nil {
 		return errors.Wrap(err, "cannot create database")
@@ -31,7 +37,7 @@ func createDatabase(ctx context.Context, db starling.ExecContexter, name string)
 }
 
 func dropUser(ctx context.Context, db starling.ExecContexter, username string) error {
-	query := fmt.Sprintf(`DROP USER IF EXISTS %s`, pq.QuoteIdentifier(username))
+	query := fmt.Sprintf(`DROP ROLE IF EXISTS %s`, pq.QuoteIdentifier(username))
 
 	if _, err := db.ExecContext(ctx, query); err != nil {
 		return errors.Wrap(err, "cannot drop user")
@@ -40,8 +46,24 @@ func dropUser(ctx context.Context, db starling.ExecContexter, username string) e
 	return nil
 }
 
-func createUser(ctx context.Context, db starling.ExecContexter, username, password string) error {
+// userExists returns true if the user exists in the cluster.
+func userExists(ctx context.Context, db starling.QueryRowContexter, username string) (bool, error) {
+	var exists bool
+
+	row := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, username)
+	if err := row.Scan(&exists); err != nil {
+		return false, errors.Wrap(err, "cannot select user")
+	}
+
+	return exists, nil
+}
+
+// createUser creates a user which can log in until validUntil if it's not nil.
+func createUser(ctx context.Context, db starling.ExecContexter, username, password string, validUntil *time.Time) error {
 	query := fmt.Sprintf(`CREATE USER %s WITH ENCRYPTED PASSWORD %s`, pq.QuoteIdentifier(username), pq.QuoteLiteral(password))
+	if validUntil != nil {
+		query += fmt.Sprintf(` VALID UNTIL %s`, pq.QuoteLiteral(validUntil.UTC().Format(time.RFC3339Nano)))
+	}
 
 	if _, err := db.ExecContext(ctx, query); err != nil {
 		return errors.Wrap(err, "cannot create user")
@@ -59,3 +81,56 @@ func grantAllPrivileges(ctx context.Context, db starling.ExecContexter, database
 
 	return nil
 }
+
+// alterDatabaseOwner makes the user the owner of the database, so the user
+// owns the public schema too.
+func alterDatabaseOwner(ctx context.Context, db starling.ExecContexter, database, username string) error {
+	query := fmt.Sprintf(`ALTER DATABASE %s OWNER TO %s`, pq.QuoteIdentifier(database), pq.QuoteIdentifier(username))
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return errors.Wrap(err, "cannot alter owner of database")
+	}
+
+	return nil
+}
+
+// revokePublic revokes default privileges of PUBLIC on the database, so only
+// users with explicit grants can connect to it.
+func revokePublic(ctx context.Context, db starling.ExecContexter, database string) error {
+	query := fmt.Sprintf(`REVOKE CONNECT, TEMPORARY ON DATABASE %s FROM PUBLIC`, pq.QuoteIdentifier(database))
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return errors.Wrap(err, "cannot revoke privileges from public")
+	}
+
+	return nil
+}
+
+// terminateUserConnections terminates all connections of the user.
+func terminateUserConnections(ctx context.Context, db starling.ExecContexter, username string) error {
+	_, err := db.ExecContext(ctx, `
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE usename = $1
+	`, username)
+	if err != nil {
+		return errors.Wrap(err, "cannot terminate connections")
+	}
+
+	return nil
+}
+
+// terminateConnections terminates all connections to the database except the
+// current one.
+func terminateConnections(ctx context.Context, db starling.ExecContexter, database string) error {
+	_, err := db.ExecContext(ctx, `
+		SELECT pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid()
+	`, database)
+	if err != nil {
+		return errors.Wrap(err, "cannot terminate connections")
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/pkg/starling"
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// Templates built from migrations are named by the hash of migrations, so
+// every librarian instance uses the same template for the same migrations.
+// Migrations are applied by a role with the same name, which has no
+// privileges except owning the template.
+const templatePrefix = "tpl_"
+
+type template struct {
+	ID   int
+	Hash string
+	Name string
+	// Role owns objects which migrations create, it's empty for templates
+	// built by the root user
+	Role string
+}
+
+// hashMigrations returns the hash of names and contents of migrations in
+// order.
+func hashMigrations(migrations []librarian.Migration) string {
+	h := sha256.New()
+
+	for _, m := range migrations {
+		// NOTE: lengths make the hash unambiguous.
+		fmt.Fprintf(h, "%d:%s%d:%s", len(m.Name), m.Name, len(m.SQL), m.SQL)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// migrationTemplate returns the template database with applied migrations.
+// The template is built only once for the same migrations.
+func (p *Postgres) migrationTemplate(ctx context.Context, migrations []librarian.Migration, now time.Time) (*template, error) {
+	t := &template{
+		ID:   0,
+		Hash: hashMigrations(migrations),
+		Name: "",
+		Role: "",
+	}
+
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		// NOTE: other instances wait here until the template is built.
+		if err := lockTemplate(ctx, tx, t.Hash); err != nil {
+			return err
+		}
+
+		var role sql.NullString
+
+		row := tx.QueryRowContext(ctx, `
+			UPDATE templates
+			SET used_at = $1
+			WHERE hash = $2
+			RETURNING id, name, role
+		`, now, t.Hash)
+
+		err := row.Scan(&t.ID, &t.Name, &role)
+		if err == nil && role.Valid {
+			t.Role = role.String
+			return nil
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return errors.Wrap(err, "cannot select template")
+		}
+
+		// NOTE: objects of templates built by the root user can't be given
+		// to users, so such templates are rebuilt.
+		if err == nil {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM templates WHERE id = $1`, t.ID); err != nil {
+				return errors.Wrap(err, "cannot delete template built by root user")
+			}
+
+			if err := p.dropTemplate(ctx, t); err != nil {
+				return errors.Wrap(err, "cannot drop template built by root user")
+			}
+		}
+
+		t.Name = templatePrefix + t.Hash[:32]
+		t.Role = t.Name
+
+		if err := p.buildTemplate(ctx, t.Name, t.Role, migrations); err != nil {
+			return errors.Wrap(err, "cannot build template")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO templates (hash, name, role, created_at, used_at)
+			VALUES ($1, $2, $3, $4, $4)
+		`, t.Hash, t.Name, t.Role, now)
+		if err != nil {
+			return errors.Wrap(err, "cannot insert template")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get template")
+	}
+
+	return t, nil
+}
+
+// buildTemplate creates the template database and applies migrations to it as
+// the role, because migrations come from users and must not run with
+// privileges of the root user. The role owns the database while migrations
+// are applied and can't log in afterwards. The database and the role are
+// dropped if migrations fail.
+func (p *Postgres) buildTemplate(ctx context.Context, name, role string, migrations []librarian.Migration) (err error) {
+	// NOTE: the database and the role could be left by a failed build.
+	if _, err := p.rootDB.ExecContext(ctx, fmt.Sprintf(`DROP DATABASE IF EXISTS %s`, pq.QuoteIdentifier(name))); err != nil {
+		return errors.Wrap(err, "cannot drop stale template database")
+	}
+	if err := dropUser(ctx, p.rootDB, role); err != nil {
+		return errors.Wrap(err, "cannot drop stale template role")
+	}
+
+	password := librarian.GeneratePassword()
+
+	if err := p.addUser(ctx, role, password, nil); err != nil {
+		return errors.Wrap(err, "cannot create template role")
+	}
+
+	if err := createDatabase(ctx, p.rootDB, name, ""); err != nil {
+		dropUser(ctx, p.rootDB, role) // nolint:errcheck,gosec
+		return errors.Wrap(err, "cannot create template database")
+	}
+
+	defer func() {
+		if err != nil {
+			dropDatabase(ctx, p.rootDB, name) // nolint:errcheck,gosec
+			dropUser(ctx, p.rootDB, role)     // nolint:errcheck,gosec
+		}
+	}()
+
+	if err := alterDatabaseOwner(ctx, p.rootDB, name, role); err != nil {
+		return errors.Wrap(err, "cannot make role the owner of template database")
+	}
+
+	db, err := connect(ctx, &connectOptions{
+		Scheme:   p.scheme,
+		Host:     p.host,
+		Port:     p.port,
+		Database: name,
+		Username: role,
+		Password: password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to template database")
+	}
+
+	err = starling.Transaction(ctx, db, func(tx *sql.Tx) error {
+		for _, m := range migrations {
+			if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+				if e, ok := errors.Cause(err).(*pq.Error); ok {
+					return errors.Wrapf(librarian.ErrInvalidInput, "migration %s failed: %s", m.Name, e.Message)
+				}
+
+				return errors.Wrapf(err, "cannot apply migration %s", m.Name)
+			}
+		}
+
+		return nil
+	})
+
+	if cerr := db.Close(); cerr != nil && err == nil {
+		err = errors.Wrap(cerr, "cannot close connection with template database")
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot apply migrations")
+	}
+
+	if _, err := p.rootDB.ExecContext(ctx, fmt.Sprintf(`ALTER ROLE %s NOLOGIN`, pq.QuoteIdentifier(role))); err != nil {
+		return errors.Wrap(err, "cannot forbid template role to log in")
+	}
+
+	// NOTE: the database is a shared object, so REASSIGN OWNED in copies would
+	// give it to their users.
+	query := fmt.Sprintf(`ALTER DATABASE %s OWNER TO CURRENT_USER`, pq.QuoteIdentifier(name))
+	if _, err := p.rootDB.ExecContext(ctx, query); err != nil {
+		return errors.Wrap(err, "cannot take template database from role")
+	}
+
+	// NOTE: nobody can connect to the template, so it can always be cloned.
+	query = fmt.Sprintf(`ALTER DATABASE %s WITH IS_TEMPLATE true ALLOW_CONNECTIONS false`, pq.QuoteIdentifier(name))
+	if _, err := p.rootDB.ExecContext(ctx, query); err != nil {
+		return errors.Wrap(err, "cannot mark database as template")
+	}
+
+	return nil
+}
+
+// adoptTemplate returns setup which makes the user of a new DB the owner of
+// objects of the template role, so the user can alter and drop them. Then it
+// calls next if it's not nil.
+func (p *Postgres) adoptTemplate(role string, next func(ctx context.Context, db *librarian.DB) error) func(ctx context.Context, db *librarian.DB) error {
+	return func(ctx context.Context, db *librarian.DB) error {
+		err := p.inDatabase(ctx, db.Database, func(tx *sql.Tx) error {
+			return revokeAll(ctx, tx, []string{role}, db.Username)
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot give objects of template to user")
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		return next(ctx, db)
+	}
+}
+
+// dropTemplate drops the template database and its role.
+func (p *Postgres) dropTemplate(ctx context.Context, t *template) error {
+	query := fmt.Sprintf(`ALTER DATABASE %s WITH IS_TEMPLATE false`, pq.QuoteIdentifier(t.Name))
+	if _, err := p.rootDB.ExecContext(ctx, query); err != nil {
+		return errors.Wrap(err, "cannot unmark database as template")
+	}
+
+	if err := dropDatabase(ctx, p.rootDB, t.Name); err != nil {
+		return errors.Wrap(err, "cannot drop template database")
+	}
+
+	// NOTE: objects of the role are given to users in copies, so the role
+	// owns nothing after the template is dropped.
+	if t.Role != "" {
+		if err := dropUser(ctx, p.rootDB, t.Role); err != nil {
+			return errors.Wrap(err, "cannot drop template role")
+		}
+	}
+
+	return nil
+}
+
+// deleteUnusedTemplates drops templates which weren't used since
+// templateTTL.
+func (p *Postgres) deleteUnusedTemplates(ctx context.Context, now time.Time) error {
+	rows, err := p.managementDB.QueryContext(ctx, `
+		SELECT id, hash, name, COALESCE(role, '')
+		FROM templates
+		WHERE used_at < $1
+	`, now.Add(-p.templateTTL))
+	if err != nil {
+		return errors.Wrap(err, "cannot select unused templates")
+	}
+	defer rows.Close() // nolint:gosec,errcheck
+
+	var templates []template
+	for rows.Next() {
+		var t template
+		if err := rows.Scan(&t.ID, &t.Hash, &t.Name, &t.Role); err != nil {
+			return errors.Wrap(err, "cannot scan template")
+		}
+
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "cannot iterate over templates")
+	}
+
+	for _, t := range templates {
+		t := t
+
+		err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+			if err := lockTemplate(ctx, tx, t.Hash); err != nil {
+				return err
+			}
+
+			// NOTE: the template could be used while we were waiting for the lock.
+			res, err := tx.ExecContext(ctx, `
+				DELETE FROM templates
+				WHERE id = $1 AND used_at < $2
+			`, t.ID, now.Add(-p.templateTTL))
+			if err != nil {
+				return errors.Wrap(err, "cannot delete template")
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return errors.Wrap(err, "cannot get number of deleted templates")
+			}
+			if n == 0 {
+				return nil
+			}
+
+			return p.dropTemplate(ctx, &t)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "cannot delete template %s", t.Name)
+		}
+	}
+
+	return nil
+}
+
+// lockTemplate locks the template with the given hash until the end of the
+// transaction.
+func lockTemplate(ctx context.Context, tx *sql.Tx, hash string) error {
+	// NOTE: advisory lock keys are numbers, the first 15 hex digits fit int64.
+	key, err := strconv.ParseInt(hash[:15], 16, 64)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse template hash")
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, key); err != nil {
+		return errors.Wrap(err, "cannot lock template")
+	}
+
+	return nil
+}
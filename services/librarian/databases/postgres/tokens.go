@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+var _ librarian.Authenticator = (*Postgres)(nil)
+
+// tokenPrefix makes API tokens recognizable, e.g. by secret scanners.
+const tokenPrefix = "lbr_"
+
+// tenantSeparator separates namespaces of tenants of other authenticators,
+// e.g. "jwt:alice", so tenants of API tokens can't contain it.
+const tenantSeparator = ":"
+
+// CreateToken creates an API token of the tenant and returns its ID and the
+// token itself. Only the hash of the token is stored, so it can't be shown
+// again.
+func (p *Postgres) CreateToken(ctx context.Context, name, tenant string, admin bool) (int, string, error) {
+	if tenant == "" {
+		return 0, "", errors.Wrap(librarian.ErrInvalidInput, "tenant must not be empty")
+	}
+	if strings.Contains(tenant, tenantSeparator) {
+		return 0, "", errors.Wrapf(librarian.ErrInvalidInput, "tenant must not contain %q", tenantSeparator)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return 0, "", errors.Wrap(err, "cannot generate token")
+	}
+
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	row := p.managementDB.QueryRowContext(ctx, `
+		INSERT INTO tokens (hash, name, tenant, admin, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, hashToken(token), name, tenant, admin, nowFunc())
+
+	var id int
+	if err := row.Scan(&id); err != nil {
+		return 0, "", errors.Wrap(categorize(err), "cannot insert token")
+	}
+
+	return id, token, nil
+}
+
+// RevokeToken revokes the API token with the given ID.
+func (p *Postgres) RevokeToken(ctx context.Context, id int) error {
+	res, err := p.managementDB.ExecContext(ctx, `
+		UPDATE tokens
+		SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL
+	`, nowFunc(), id)
+	if err != nil {
+		return errors.Wrap(categorize(err), "cannot revoke token")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "cannot get number of revoked tokens")
+	}
+	if n == 0 {
+		return errors.Wrapf(librarian.ErrNotFound, "token %d does not exist", id)
+	}
+
+	return nil
+}
+
+// Authenticate returns the principal of an API token.
+func (p *Postgres) Authenticate(ctx context.Context, token string) (*librarian.Principal, error) {
+	var principal librarian.Principal
+
+	row := p.managementDB.QueryRowContext(ctx, `
+		SELECT tenant, admin
+		FROM tokens
+		WHERE hash = $1 AND revoked_at IS NULL
+	`, hashToken(token))
+
+	err := row.Scan(&principal.Tenant, &principal.Admin)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrap(librarian.ErrUnauthenticated, "token is unknown or revoked")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot select token")
+	}
+
+	// NOTE: tokens could be created before namespaces were reserved.
+	if strings.Contains(principal.Tenant, tenantSeparator) {
+		return nil, errors.Wrapf(librarian.ErrUnauthenticated, "tenant %s of token is reserved", principal.Tenant)
+	}
+
+	return &principal, nil
+}
+
+// hashToken returns the hash of a token which is stored instead of it. Tokens
+// are random, so salt isn't needed.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,474 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/pkg/starling"
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// privileges of a role in the public schema. Empty privileges aren't granted.
+type privileges struct {
+	Database  string
+	Schema    string
+	Tables    string
+	Sequences string
+	Functions string
+}
+
+// nolint:gochecknoglobals
+var rolePrivileges = map[librarian.Role]privileges{
+	librarian.RoleOwner: {
+		Database:  "ALL PRIVILEGES",
+		Schema:    "ALL PRIVILEGES",
+		Tables:    "ALL PRIVILEGES",
+		Sequences: "ALL PRIVILEGES",
+		Functions: "ALL PRIVILEGES",
+	},
+	librarian.RoleReadWrite: {
+		Database:  "CONNECT, TEMPORARY",
+		Schema:    "USAGE",
+		Tables:    "SELECT, INSERT, UPDATE, DELETE",
+		Sequences: "USAGE, SELECT, UPDATE",
+		Functions: "EXECUTE",
+	},
+	librarian.RoleReadOnly: {
+		Database:  "CONNECT",
+		Schema:    "USAGE",
+		Tables:    "SELECT",
+		Sequences: "SELECT",
+		Functions: "",
+	},
+}
+
+// CreateUser adds a user with the given role to the DB. Privileges are granted
+// on existing objects in the public schema and on objects which owners will
+// create there.
+func (p *Postgres) CreateUser(ctx context.Context, id string, opts ...librarian.UserOption) (*librarian.User, error) {
+	options := librarian.NewUserOptions(opts...)
+
+	if _, ok := rolePrivileges[options.Role]; !ok {
+		return nil, errors.Wrapf(librarian.ErrInvalidInput, "unknown role %q", options.Role)
+	}
+
+	username := options.Username
+	if username == "" {
+		username = options.UsernameGenerator()
+	}
+
+	password := ""
+	if options.Password != nil {
+		password = *options.Password
+	} else {
+		password = options.PasswordGenerator()
+	}
+
+	now := nowFunc()
+
+	var expiredAt *time.Time
+	if options.TTL != 0 {
+		v := now.Add(options.TTL)
+
+		expiredAt = &v
+	}
+
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		// NOTE: the lock prevents deletion of the DB meanwhile.
+		d, err := p.get(ctx, tx, id, true)
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		db := d.toDB()
+		if status := db.Status(now); status != librarian.StatusActive {
+			return errors.Wrapf(librarian.ErrNotFound, "DB %s is already %s", id, status)
+		}
+
+		if _, err := p.insertUser(ctx, tx, d.ID, username, options.Role, now, expiredAt); err != nil {
+			return errors.Wrap(err, "cannot insert user")
+		}
+
+		if err := p.addUser(ctx, username, password, expiredAt); err != nil {
+			return errors.Wrap(err, "cannot create user")
+		}
+
+		err = p.inDatabase(ctx, d.Name, func(dtx *sql.Tx) error {
+			return grantRole(ctx, dtx, d.Name, username, options.Role, d.Users)
+		})
+		if err != nil {
+			// NOTE: grants are rolled back, so nothing depends on the user.
+			if derr := dropUser(ctx, p.rootDB, username); derr != nil {
+				return errors.Wrapf(err, "cannot grant privileges and drop user: %v", derr)
+			}
+
+			return errors.Wrap(err, "cannot grant privileges")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot create user")
+	}
+
+	return &librarian.User{
+		Username:  username,
+		Password:  password,
+		Role:      options.Role,
+		ExpiredAt: expiredAt,
+	}, nil
+}
+
+// DeleteUser deletes the user from the DB. Objects owned by the user are
+// reassigned to another owner. The user is deleted even if its role was
+// already dropped.
+func (p *Postgres) DeleteUser(ctx context.Context, id, username string) error {
+	now := nowFunc()
+
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		d, err := p.get(ctx, tx, id, true)
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		if d.DeletedAt != nil {
+			return errors.Wrapf(librarian.ErrNotFound, "DB %s is already deleted", id)
+		}
+
+		var (
+			deleted *user
+			owner   string
+		)
+		for i, u := range d.Users {
+			switch {
+			case u.Username == username:
+				deleted = &d.Users[i]
+			case u.Role == librarian.RoleOwner && owner == "":
+				owner = u.Username
+			}
+		}
+
+		if deleted == nil {
+			return errors.Wrapf(librarian.ErrNotFound, "user %s does not exist", username)
+		}
+		if owner == "" {
+			return errors.Wrapf(librarian.ErrConflict, "user %s is the last owner", username)
+		}
+
+		return p.deleteUser(ctx, tx, d.Name, deleted, owner, now)
+	})
+	if err != nil {
+		return errors.Wrap(categorize(err), "cannot delete user")
+	}
+
+	return nil
+}
+
+// DeleteExpiredUsers deletes expired short-lived credentials. Their sessions
+// are terminated, the DBs and other users are left intact. Every user is
+// deleted in its own transaction, so one failure doesn't keep other users.
+func (p *Postgres) DeleteExpiredUsers(ctx context.Context) ([]librarian.DB, error) {
+	now := nowFunc()
+
+	expired, err := p.expiredUsers(ctx, p.managementDB, now)
+	if err != nil {
+		return nil, errors.Wrap(categorize(err), "cannot get list of expired users")
+	}
+
+	var (
+		deletedDBs []librarian.DB
+		firstErr   error
+		failed     int
+	)
+	for _, e := range expired {
+		d, u, err := p.deleteExpiredUser(ctx, e.database, e.username, now)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(categorize(err), "cannot delete expired user %s of DB %s", e.username, e.database)
+			}
+			failed++
+			continue
+		}
+		if d == nil {
+			continue
+		}
+
+		deleted := librarian.User{
+			Username:  u.Username,
+			Password:  "",
+			Role:      u.Role,
+			ExpiredAt: u.ExpiredAt,
+		}
+
+		// NOTE: users are ordered by DBs.
+		if n := len(deletedDBs); n > 0 && deletedDBs[n-1].Database == d.Name {
+			deletedDBs[n-1].Users = append(deletedDBs[n-1].Users, deleted)
+			continue
+		}
+
+		deletedDBs = append(deletedDBs, librarian.DB{
+			Database:  d.Name,
+			Users:     []librarian.User{deleted},
+			CreatedAt: d.CreatedAt,
+			ExpiredAt: d.ExpiredAt,
+		})
+	}
+	if firstErr != nil {
+		return deletedDBs, errors.Wrapf(firstErr, "%d of %d expired users weren't deleted", failed, len(expired))
+	}
+
+	return deletedDBs, nil
+}
+
+// deleteExpiredUser deletes the user in its own transaction if it's still
+// expired. It returns nil if the user or its DB was renewed or deleted in the
+// meantime.
+func (p *Postgres) deleteExpiredUser(ctx context.Context, name, username string, now time.Time) (*database, *user, error) {
+	var (
+		deletedDB   *database
+		deletedUser *user
+	)
+
+	err := starling.Transaction(ctx, p.managementDB, func(tx *sql.Tx) error {
+		d, err := p.get(ctx, tx, name, true)
+		if errors.Cause(err) == librarian.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		if d.DeletedAt != nil {
+			return nil
+		}
+
+		var (
+			expired *user
+			owner   string
+		)
+		for i, u := range d.Users {
+			switch {
+			case u.ExpiredAt != nil && !u.ExpiredAt.After(now):
+				if u.Username == username {
+					expired = &d.Users[i]
+				}
+			case u.Role == librarian.RoleOwner && owner == "":
+				owner = u.Username
+			}
+		}
+
+		if expired == nil {
+			return nil
+		}
+
+		// NOTE: objects of the last owner are kept by the root user.
+		if owner == "" {
+			owner = p.username
+		}
+
+		if err := p.deleteUser(ctx, tx, d.Name, expired, owner, now); err != nil {
+			return err
+		}
+
+		deletedDB, deletedUser = d, expired
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return deletedDB, deletedUser, nil
+}
+
+// deleteUser revokes privileges of the user, drops it and deletes it from
+// management tables (softly if it's enabled). Objects owned by the user are
+// reassigned to the owner. Users which were dropped behind the librarian are
+// only deleted from management tables.
+func (p *Postgres) deleteUser(ctx context.Context, tx *sql.Tx, database string, u *user, owner string, now time.Time) error {
+	exists, err := userExists(ctx, p.rootDB, u.Username)
+	if err != nil {
+		return errors.Wrap(err, "cannot check user")
+	}
+
+	if exists {
+		// NOTE: the user can't be dropped while it owns objects or has
+		// privileges in the database.
+		err = p.inDatabase(ctx, database, func(dtx *sql.Tx) error {
+			return revokeAll(ctx, dtx, []string{u.Username}, owner)
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot revoke privileges")
+		}
+
+		if err := terminateUserConnections(ctx, p.rootDB, u.Username); err != nil {
+			return errors.Wrap(err, "cannot terminate connections of user")
+		}
+
+		if err := dropUser(ctx, p.rootDB, u.Username); err != nil {
+			return errors.Wrap(err, "cannot drop user")
+		}
+	}
+
+	if p.softDelete {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users
+			SET deleted_at = $1
+			WHERE id = $2
+		`, now, u.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM users
+			WHERE id = $1
+		`, u.ID)
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot delete user from users")
+	}
+
+	return nil
+}
+
+// expiredUser is a user of an alive DB which expired.
+type expiredUser struct {
+	database string
+	username string
+}
+
+// expiredUsers returns expired users of alive databases ordered by databases.
+func (p *Postgres) expiredUsers(ctx context.Context, db starling.QueryContexter, now time.Time) ([]expiredUser, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.name, u.username
+		FROM users AS u
+		JOIN databases AS d
+		ON d.id = u.database_id
+		WHERE u.deleted_at IS NULL AND u.expired_at IS NOT NULL AND u.expired_at <= $1 AND d.deleted_at IS NULL
+		ORDER BY d.name, u.username
+	`, now)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot select users")
+	}
+	defer rows.Close() // nolint:gosec,errcheck
+
+	var expired []expiredUser
+	for rows.Next() {
+		var e expiredUser
+		if err := rows.Scan(&e.database, &e.username); err != nil {
+			return nil, errors.Wrap(err, "cannot scan user")
+		}
+
+		expired = append(expired, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot iterate over users")
+	}
+
+	return expired, nil
+}
+
+// inDatabase calls fn in a transaction in the database as the root user.
+func (p *Postgres) inDatabase(ctx context.Context, database string, fn func(tx *sql.Tx) error) error {
+	conn, err := connect(ctx, &connectOptions{
+		Scheme:   p.scheme,
+		Host:     p.host,
+		Port:     p.port,
+		Database: database,
+		Username: p.username,
+		Password: p.password,
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to database")
+	}
+	defer conn.Close() // nolint:errcheck,gosec
+
+	return starling.Transaction(ctx, conn, fn)
+}
+
+// grantRole grants privileges of the role to the user. Tx must be opened in
+// the database. Users are the existing users of the database: objects which
+// owners create later are granted to the user and vice versa.
+func grantRole(ctx context.Context, tx *sql.Tx, database, username string, role librarian.Role, users []user) error {
+	privs := rolePrivileges[role]
+	grantee := pq.QuoteIdentifier(username)
+
+	queries := []string{
+		fmt.Sprintf(`GRANT %s ON DATABASE %s TO %s`, privs.Database, pq.QuoteIdentifier(database), grantee),
+		fmt.Sprintf(`GRANT %s ON SCHEMA public TO %s`, privs.Schema, grantee),
+	}
+	for _, q := range []struct{ privileges, objects string }{
+		{privs.Tables, "TABLES"},
+		{privs.Sequences, "SEQUENCES"},
+		{privs.Functions, "FUNCTIONS"},
+	} {
+		if q.privileges != "" {
+			queries = append(queries, fmt.Sprintf(`GRANT %s ON ALL %s IN SCHEMA public TO %s`, q.privileges, q.objects, grantee))
+		}
+	}
+
+	for _, u := range users {
+		if u.Role == librarian.RoleOwner {
+			queries = append(queries, alterDefaultPrivileges(u.Username, username, privs)...)
+		}
+		if role == librarian.RoleOwner {
+			queries = append(queries, alterDefaultPrivileges(username, u.Username, rolePrivileges[u.Role])...)
+		}
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "cannot grant privileges of role %s", role)
+		}
+	}
+
+	return nil
+}
+
+// alterDefaultPrivileges returns queries which grant privileges on objects
+// which the owner will create in the public schema.
+func alterDefaultPrivileges(owner, grantee string, privs privileges) []string {
+	var queries []string
+
+	for _, q := range []struct{ privileges, objects string }{
+		{privs.Tables, "TABLES"},
+		{privs.Sequences, "SEQUENCES"},
+		{privs.Functions, "FUNCTIONS"},
+	} {
+		if q.privileges != "" {
+			queries = append(queries, fmt.Sprintf(
+				`ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT %s ON %s TO %s`,
+				pq.QuoteIdentifier(owner), q.privileges, q.objects, pq.QuoteIdentifier(grantee),
+			))
+		}
+	}
+
+	return queries
+}
+
+// revokeAll reassigns objects owned by the users to the owner and revokes all
+// privileges of the users. Tx must be opened in the database.
+func revokeAll(ctx context.Context, tx *sql.Tx, usernames []string, owner string) error {
+	quoted := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		quoted = append(quoted, pq.QuoteIdentifier(username))
+	}
+
+	from := strings.Join(quoted, ", ")
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`REASSIGN OWNED BY %s TO %s`, from, pq.QuoteIdentifier(owner))); err != nil {
+		return errors.Wrap(err, "cannot reassign owned objects")
+	}
+
+	// NOTE: owned objects are already reassigned, so only privileges are
+	// dropped.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DROP OWNED BY %s`, from)); err != nil {
+		return errors.Wrap(err, "cannot drop privileges")
+	}
+
+	return nil
+}
@@ -0,0 +1,459 @@
+package sharded
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+var _ librarian.Database = (*Sharded)(nil)
+
+// Shard is a named backend of Sharded.
+type Shard struct {
+	Name     string
+	Database librarian.Database
+}
+
+// Catalog keeps shards of DBs, so all instances of the librarian agree on
+// them and names of DBs are unique across shards. Shards are referred to by
+// their names, so they can be reordered.
+type Catalog interface {
+	// PlaceDB records the shard of the DB. It returns librarian.ErrConflict if
+	// the DB is already placed.
+	PlaceDB(ctx context.Context, id, shard string) error
+	// ShardOf returns the shard of the DB or librarian.ErrNotFound.
+	ShardOf(ctx context.Context, id string) (string, error)
+	// UnplaceDB forgets the shard of the DB.
+	UnplaceDB(ctx context.Context, id string) error
+}
+
+type Option func(*Sharded)
+
+func WithStrategy(strategy Strategy) Option {
+	return func(o *Sharded) { o.strategy = strategy }
+}
+
+// WithCatalog keeps shards of DBs in the catalog. Without it, DBs are looked
+// up on every shard.
+func WithCatalog(catalog Catalog) Option {
+	return func(o *Sharded) { o.catalog = catalog }
+}
+
+// Sharded fronts several databases and places every new DB on one of them.
+//
+// Unknown DBs, e.g. created before the catalog was set, are looked up on every
+// shard and placed in the catalog.
+type Sharded struct {
+	shards   []Shard
+	strategy Strategy
+	catalog  Catalog
+}
+
+// New returns an error if there are no shards, strategies can't place DBs
+// then.
+func New(shards []Shard, opts ...Option) (*Sharded, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("no shards")
+	}
+
+	s := &Sharded{
+		shards:   shards,
+		strategy: NewRoundRobin(),
+		catalog:  nil,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+func (s *Sharded) Create(ctx context.Context, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	options := librarian.NewCreaterOptions(opts...)
+
+	// NOTE: we generate the name here, so strategies can rely on it.
+	name := options.Database
+	if name == "" {
+		name = options.DBNameGenerator()
+	} else if err := s.checkName(ctx, name); err != nil {
+		return nil, err
+	}
+
+	index, err := s.strategy.Place(ctx, name, s.shards)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot place DB")
+	}
+
+	shard := s.shards[index]
+
+	if err := s.place(ctx, name, index); err != nil {
+		return nil, err
+	}
+
+	// NOTE: full slice expression prevents appending to the caller's array.
+	opts = append(opts[:len(opts):len(opts)], librarian.WithDatabase(name))
+
+	db, err := shard.Database.Create(ctx, opts...)
+	if err != nil {
+		s.forget(ctx, name)
+		return nil, errors.Wrapf(err, "cannot create DB on shard %s", shard.Name)
+	}
+
+	return db, nil
+}
+
+func (s *Sharded) Get(ctx context.Context, id string) (*librarian.DB, error) {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	db, err := s.shards[index].Database.Get(ctx, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get DB from shard %s", s.shards[index].Name)
+	}
+
+	return db, nil
+}
+
+var _ librarian.Pinger = (*Sharded)(nil)
+
+// Ping pings shards which implement librarian.Pinger. All shards must be
+// available, because DBs are placed on all of them.
+func (s *Sharded) Ping(ctx context.Context) error {
+	for _, shard := range s.shards {
+		pinger, ok := shard.Database.(librarian.Pinger)
+		if !ok {
+			continue
+		}
+
+		if err := pinger.Ping(ctx); err != nil {
+			return errors.Wrapf(err, "cannot ping shard %s", shard.Name)
+		}
+	}
+
+	return nil
+}
+
+// List merges sorted lists of shards. Every shard returns up to the limit, so
+// the merged list is cut to it.
+func (s *Sharded) List(ctx context.Context, opts ...librarian.ListerOption) ([]librarian.DB, error) {
+	options := librarian.NewListerOptions(opts...)
+
+	var dbs []librarian.DB
+
+	for _, shard := range s.shards {
+		list, err := shard.Database.List(ctx, opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list DBs of shard %s", shard.Name)
+		}
+
+		dbs = append(dbs, list...)
+	}
+
+	orders := options.Sort
+	if len(orders) == 0 {
+		orders = librarian.DefaultSort
+	}
+
+	sort.SliceStable(dbs, func(i, j int) bool {
+		return librarian.Less(librarian.CursorOf(&dbs[i]), librarian.CursorOf(&dbs[j]), orders)
+	})
+
+	if options.Limit > 0 && len(dbs) > options.Limit {
+		dbs = dbs[:options.Limit]
+	}
+
+	return dbs, nil
+}
+
+// Count sums counts of shards.
+func (s *Sharded) Count(ctx context.Context, opts ...librarian.ListerOption) (int, error) {
+	var count int
+
+	for _, shard := range s.shards {
+		n, err := shard.Database.Count(ctx, opts...)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot count DBs of shard %s", shard.Name)
+		}
+
+		count += n
+	}
+
+	return count, nil
+}
+
+// Usage sums usages of shards, so quotas apply to all shards together.
+func (s *Sharded) Usage(ctx context.Context, owner string) (librarian.Usage, error) {
+	var usage librarian.Usage
+
+	for _, shard := range s.shards {
+		u, err := shard.Database.Usage(ctx, owner)
+		if err != nil {
+			return librarian.Usage{}, errors.Wrapf(err, "cannot get usage of shard %s", shard.Name)
+		}
+
+		usage.Databases += u.Databases
+		usage.DBTime += u.DBTime
+	}
+
+	return usage, nil
+}
+
+// DeleteExpired deletes expired DBs on every shard. A failed shard doesn't
+// stop others; DBs deleted before the error are returned with it.
+func (s *Sharded) DeleteExpired(ctx context.Context) ([]librarian.DB, error) {
+	var (
+		deleted []librarian.DB
+		err     error
+	)
+
+	for _, shard := range s.shards {
+		dbs, serr := shard.Database.DeleteExpired(ctx)
+		if serr != nil && err == nil {
+			err = errors.Wrapf(serr, "cannot delete expired DBs of shard %s", shard.Name)
+		}
+
+		for _, db := range dbs {
+			s.forget(ctx, db.Database)
+		}
+
+		deleted = append(deleted, dbs...)
+	}
+
+	return deleted, err
+}
+
+// DeleteExpiredUsers deletes expired users on every shard like DeleteExpired.
+func (s *Sharded) DeleteExpiredUsers(ctx context.Context) ([]librarian.DB, error) {
+	var (
+		deleted []librarian.DB
+		err     error
+	)
+
+	for _, shard := range s.shards {
+		dbs, serr := shard.Database.DeleteExpiredUsers(ctx)
+		if serr != nil && err == nil {
+			err = errors.Wrapf(serr, "cannot delete expired users of shard %s", shard.Name)
+		}
+
+		deleted = append(deleted, dbs...)
+	}
+
+	return deleted, err
+}
+
+func (s *Sharded) Renew(ctx context.Context, id string, ttl time.Duration) (*librarian.DB, error) {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	db, err := s.shards[index].Database.Renew(ctx, id, ttl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot renew DB on shard %s", s.shards[index].Name)
+	}
+
+	return db, nil
+}
+
+func (s *Sharded) Delete(ctx context.Context, id string) error {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	if err := s.shards[index].Database.Delete(ctx, id); err != nil {
+		return errors.Wrapf(err, "cannot delete DB on shard %s", s.shards[index].Name)
+	}
+
+	s.forget(ctx, id)
+
+	return nil
+}
+
+// Clone copies the DB on the shard which owns it, because databases can't be
+// copied between servers.
+func (s *Sharded) Clone(ctx context.Context, id string, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	options := librarian.NewCreaterOptions(opts...)
+
+	name := options.Database
+	if name == "" {
+		name = options.DBNameGenerator()
+	} else if err := s.checkName(ctx, name); err != nil {
+		return nil, err
+	}
+
+	if err := s.place(ctx, name, index); err != nil {
+		return nil, err
+	}
+
+	// NOTE: full slice expression prevents appending to the caller's array.
+	opts = append(opts[:len(opts):len(opts)], librarian.WithDatabase(name))
+
+	db, err := s.shards[index].Database.Clone(ctx, id, opts...)
+	if err != nil {
+		s.forget(ctx, name)
+		return nil, errors.Wrapf(err, "cannot clone DB on shard %s", s.shards[index].Name)
+	}
+
+	return db, nil
+}
+
+func (s *Sharded) Assign(ctx context.Context, id string, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	db, err := s.shards[index].Database.Assign(ctx, id, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot assign DB on shard %s", s.shards[index].Name)
+	}
+
+	return db, nil
+}
+
+func (s *Sharded) CreateUser(ctx context.Context, id string, opts ...librarian.UserOption) (*librarian.User, error) {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	user, err := s.shards[index].Database.CreateUser(ctx, id, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create user on shard %s", s.shards[index].Name)
+	}
+
+	return user, nil
+}
+
+func (s *Sharded) DeleteUser(ctx context.Context, id, username string) error {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "cannot find shard of DB")
+	}
+
+	if err := s.shards[index].Database.DeleteUser(ctx, id, username); err != nil {
+		return errors.Wrapf(err, "cannot delete user on shard %s", s.shards[index].Name)
+	}
+
+	return nil
+}
+
+// Shard returns the name of the shard which owns the DB.
+func (s *Sharded) Shard(ctx context.Context, id string) (string, error) {
+	index, err := s.owner(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return s.shards[index].Name, nil
+}
+
+// owner returns the index of the shard which owns the DB. The placement of
+// the DB isn't checked, so the DB can be already deleted.
+func (s *Sharded) owner(ctx context.Context, id string) (int, error) {
+	if s.catalog != nil {
+		name, err := s.catalog.ShardOf(ctx, id)
+		if err == nil {
+			for i, shard := range s.shards {
+				if shard.Name == name {
+					return i, nil
+				}
+			}
+
+			return 0, errors.Errorf("DB %s is placed on unknown shard %s", id, name)
+		}
+		if errors.Cause(err) != librarian.ErrNotFound {
+			return 0, errors.Wrap(err, "cannot get shard of DB from catalog")
+		}
+	}
+
+	for i, shard := range s.shards {
+		_, err := shard.Database.Get(ctx, id)
+		if errors.Cause(err) == librarian.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot get DB from shard %s", shard.Name)
+		}
+
+		// NOTE: another instance can place the DB at the same time.
+		if err := s.place(ctx, id, i); err != nil && errors.Cause(err) != librarian.ErrConflict {
+			return 0, err
+		}
+
+		return i, nil
+	}
+
+	return 0, errors.Wrapf(librarian.ErrNotFound, "DB %s does not exist", id)
+}
+
+// checkName returns librarian.ErrConflict if a DB with the name exists on any
+// shard, because names are unique only inside a shard. Placements of DBs which
+// no longer exist are removed.
+func (s *Sharded) checkName(ctx context.Context, name string) error {
+	index, err := s.owner(ctx, name)
+	if errors.Cause(err) == librarian.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot check DB existence")
+	}
+
+	_, err = s.shards[index].Database.Get(ctx, name)
+	if err == nil {
+		return errors.Wrapf(librarian.ErrConflict, "DB %s already exists", name)
+	}
+	if errors.Cause(err) != librarian.ErrNotFound {
+		return errors.Wrapf(err, "cannot get DB from shard %s", s.shards[index].Name)
+	}
+
+	if s.catalog != nil {
+		if err := s.catalog.UnplaceDB(ctx, name); err != nil {
+			return errors.Wrap(err, "cannot delete stale placement of DB")
+		}
+	}
+
+	return nil
+}
+
+// place records the shard of the DB in the catalog. It returns
+// librarian.ErrConflict if the DB is already placed, e.g. it's created by
+// another instance at the same time.
+func (s *Sharded) place(ctx context.Context, id string, index int) error {
+	if s.catalog == nil {
+		return nil
+	}
+
+	err := s.catalog.PlaceDB(ctx, id, s.shards[index].Name)
+	if errors.Cause(err) == librarian.ErrConflict {
+		return errors.Wrapf(librarian.ErrConflict, "DB %s already exists", id)
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot place DB in catalog")
+	}
+
+	return nil
+}
+
+// forget removes the placement of a deleted DB. Errors are ignored, because a
+// stale placement only costs a lookup and is removed by checkName.
+func (s *Sharded) forget(ctx context.Context, id string) {
+	if s.catalog == nil {
+		return
+	}
+
+	s.catalog.UnplaceDB(ctx, id) // nolint:errcheck,gosec
+}
@@ -0,0 +1,441 @@
+package sharded
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// fakeShard keeps DBs in memory. Methods which aren't used by tests panic.
+type fakeShard struct {
+	librarian.Database
+
+	mu   sync.Mutex
+	dbs  map[string]librarian.DB
+	gets int
+}
+
+func newFakeShard(dbs ...librarian.DB) *fakeShard {
+	f := &fakeShard{
+		Database: nil,
+
+		mu:   sync.Mutex{},
+		dbs:  make(map[string]librarian.DB),
+		gets: 0,
+	}
+
+	for _, db := range dbs {
+		f.dbs[db.Database] = db
+	}
+
+	return f
+}
+
+func (f *fakeShard) Create(ctx context.Context, opts ...librarian.CreaterOption) (*librarian.DB, error) {
+	options := librarian.NewCreaterOptions(opts...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.dbs[options.Database]; ok {
+		return nil, errors.Wrapf(librarian.ErrConflict, "DB %s already exists", options.Database)
+	}
+
+	db := librarian.DB{
+		Database:  options.Database,
+		Owner:     options.Owner,
+		Labels:    options.Labels,
+		CreatedAt: time.Now(),
+	}
+	if options.TTL != 0 {
+		expiredAt := db.CreatedAt.Add(options.TTL)
+		db.ExpiredAt = &expiredAt
+	}
+
+	f.dbs[db.Database] = db
+
+	return &db, nil
+}
+
+func (f *fakeShard) Get(ctx context.Context, id string) (*librarian.DB, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.gets++
+
+	db, ok := f.dbs[id]
+	if !ok {
+		return nil, errors.Wrapf(librarian.ErrNotFound, "DB %s does not exist", id)
+	}
+
+	return &db, nil
+}
+
+func (f *fakeShard) List(ctx context.Context, opts ...librarian.ListerOption) ([]librarian.DB, error) {
+	options := librarian.NewListerOptions(opts...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var dbs []librarian.DB
+	for _, db := range f.dbs {
+		if options.Owner != "" && db.Owner != options.Owner {
+			continue
+		}
+		if options.After != nil && !librarian.Less(*options.After, librarian.CursorOf(&db), options.Sort) {
+			continue
+		}
+
+		dbs = append(dbs, db)
+	}
+
+	sort.Slice(dbs, func(i, j int) bool {
+		return librarian.Less(librarian.CursorOf(&dbs[i]), librarian.CursorOf(&dbs[j]), options.Sort)
+	})
+
+	if options.Limit > 0 && len(dbs) > options.Limit {
+		dbs = dbs[:options.Limit]
+	}
+
+	return dbs, nil
+}
+
+func (f *fakeShard) Count(ctx context.Context, opts ...librarian.ListerOption) (int, error) {
+	options := librarian.NewListerOptions(opts...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	for _, db := range f.dbs {
+		if options.Owner == "" || db.Owner == options.Owner {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (f *fakeShard) Usage(ctx context.Context, owner string) (librarian.Usage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var usage librarian.Usage
+
+	now := time.Now()
+	for _, db := range f.dbs {
+		if db.Owner != owner || db.Status(now) != librarian.StatusActive {
+			continue
+		}
+
+		usage.Databases++
+		if db.ExpiredAt != nil {
+			usage.DBTime += db.ExpiredAt.Sub(now)
+		}
+	}
+
+	return usage, nil
+}
+
+func (f *fakeShard) Delete(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.dbs[id]; !ok {
+		return errors.Wrapf(librarian.ErrNotFound, "DB %s does not exist", id)
+	}
+
+	delete(f.dbs, id)
+
+	return nil
+}
+
+func (f *fakeShard) resetGets() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.gets = 0
+}
+
+// fakeCatalog keeps placements in memory.
+type fakeCatalog struct {
+	mu         sync.Mutex
+	placements map[string]string
+}
+
+func newFakeCatalog() *fakeCatalog {
+	return &fakeCatalog{
+		mu:         sync.Mutex{},
+		placements: make(map[string]string),
+	}
+}
+
+func (c *fakeCatalog) PlaceDB(ctx context.Context, id, shard string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.placements[id]; ok {
+		return errors.Wrapf(librarian.ErrConflict, "DB %s is already placed", id)
+	}
+
+	c.placements[id] = shard
+
+	return nil
+}
+
+func (c *fakeCatalog) ShardOf(ctx context.Context, id string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	shard, ok := c.placements[id]
+	if !ok {
+		return "", errors.Wrapf(librarian.ErrNotFound, "DB %s isn't placed", id)
+	}
+
+	return shard, nil
+}
+
+func (c *fakeCatalog) UnplaceDB(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.placements, id)
+
+	return nil
+}
+
+func newSharded(t *testing.T, shards []Shard, opts ...Option) *Sharded {
+	t.Helper()
+
+	s, err := New(shards, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestNewWithoutShards(t *testing.T) {
+	for _, shards := range [][]Shard{nil, {}} {
+		if s, err := New(shards, WithStrategy(NewRoundRobin())); err == nil {
+			t.Errorf("New(%v) = %v, want error", shards, s)
+		}
+	}
+}
+
+func TestShardedCatalog(t *testing.T) {
+	ctx := context.Background()
+
+	a, b := newFakeShard(), newFakeShard()
+	shards := []Shard{{Name: "a", Database: a}, {Name: "b", Database: b}}
+	catalog := newFakeCatalog()
+
+	s1 := newSharded(t, shards, WithCatalog(catalog))
+	for _, name := range []string{"db-1", "db-2"} {
+		if _, err := s1.Create(ctx, librarian.WithDatabase(name)); err != nil {
+			t.Fatalf("Create(%s) error = %v", name, err)
+		}
+	}
+
+	// Another instance, e.g. after a restart, finds DBs without scanning
+	s2 := newSharded(t, shards, WithCatalog(catalog))
+	a.resetGets()
+	b.resetGets()
+
+	for name, want := range map[string]string{"db-1": "a", "db-2": "b"} {
+		shard, err := s2.Shard(ctx, name)
+		if err != nil {
+			t.Fatalf("Shard(%s) error = %v", name, err)
+		}
+		if shard != want {
+			t.Errorf("Shard(%s) = %s, want %s", name, shard, want)
+		}
+	}
+	if a.gets+b.gets != 0 {
+		t.Errorf("shards were scanned %d times, want 0", a.gets+b.gets)
+	}
+
+	// Names are unique across shards and instances
+	if _, err := s2.Create(ctx, librarian.WithDatabase("db-1")); errors.Cause(err) != librarian.ErrConflict {
+		t.Errorf("Create(db-1) error = %v, want %v", err, librarian.ErrConflict)
+	}
+
+	if err := s2.Delete(ctx, "db-1"); err != nil {
+		t.Fatalf("Delete(db-1) error = %v", err)
+	}
+	if _, err := catalog.ShardOf(ctx, "db-1"); errors.Cause(err) != librarian.ErrNotFound {
+		t.Errorf("placement of deleted DB: error = %v, want %v", err, librarian.ErrNotFound)
+	}
+	if _, err := s1.Create(ctx, librarian.WithDatabase("db-1")); err != nil {
+		t.Errorf("Create(db-1) after delete error = %v", err)
+	}
+}
+
+func TestShardedStalePlacement(t *testing.T) {
+	ctx := context.Background()
+
+	a, b := newFakeShard(), newFakeShard(librarian.DB{Database: "db-old", CreatedAt: time.Now()})
+	catalog := newFakeCatalog()
+	s := newSharded(t, []Shard{{Name: "a", Database: a}, {Name: "b", Database: b}}, WithCatalog(catalog))
+
+	// DBs created before the catalog are placed on the first lookup
+	if _, err := s.Get(ctx, "db-old"); err != nil {
+		t.Fatalf("Get(db-old) error = %v", err)
+	}
+	if shard, _ := catalog.ShardOf(ctx, "db-old"); shard != "b" {
+		t.Errorf("db-old is placed on %q, want b", shard)
+	}
+
+	// Placements of DBs which were deleted behind the catalog are replaced
+	if err := catalog.PlaceDB(ctx, "db-gone", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "db-gone"); errors.Cause(err) != librarian.ErrNotFound {
+		t.Errorf("Get(db-gone) error = %v, want %v", err, librarian.ErrNotFound)
+	}
+	if _, err := s.Create(ctx, librarian.WithDatabase("db-gone")); err != nil {
+		t.Errorf("Create(db-gone) error = %v", err)
+	}
+}
+
+func TestShardedQuota(t *testing.T) {
+	ctx := context.Background()
+
+	a, b := newFakeShard(), newFakeShard()
+	s := newSharded(t, []Shard{{Name: "a", Database: a}, {Name: "b", Database: b}})
+
+	l := librarian.New()
+	if err := l.Register("sharded", s); err != nil {
+		t.Fatal(err)
+	}
+
+	quota := librarian.Quota{MaxDatabases: 2, MaxTTL: 0, MaxDBHours: 0}
+	enforcer := librarian.NewEnforcer(l, &librarian.Quotas{Default: quota, Tenants: nil})
+
+	// Round robin places every DB on its own shard
+	for i := 0; i < 2; i++ {
+		if _, err := enforcer.Create(ctx, s, librarian.WithOwner("ci")); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	_, err := enforcer.Create(ctx, s, librarian.WithOwner("ci"))
+	if qerr, ok := errors.Cause(err).(*librarian.QuotaError); !ok || qerr.Limit != librarian.LimitDatabases {
+		t.Errorf("Create() error = %v, want %s quota error", err, librarian.LimitDatabases)
+	}
+
+	usage, err := s.Usage(ctx, "ci")
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+	if usage.Databases != 2 {
+		t.Errorf("usage of %d DBs, want 2", usage.Databases)
+	}
+	if len(a.dbs) != 1 || len(b.dbs) != 1 {
+		t.Errorf("shards have %d and %d DBs, want 1 and 1", len(a.dbs), len(b.dbs))
+	}
+}
+
+func TestShardedListPages(t *testing.T) {
+	ctx := context.Background()
+
+	t0 := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		v := t0.Add(time.Duration(minutes) * time.Minute)
+		return &v
+	}
+
+	// NOTE: DBs created at the same time on different shards test ties.
+	shards := []Shard{
+		{Name: "a", Database: newFakeShard(
+			librarian.DB{Database: "db_a1", CreatedAt: t0, ExpiredAt: at(30)},
+			librarian.DB{Database: "db_a2", CreatedAt: *at(1), ExpiredAt: nil},
+			librarian.DB{Database: "db_x3", CreatedAt: *at(2), ExpiredAt: at(10)},
+		)},
+		{Name: "b", Database: newFakeShard(
+			librarian.DB{Database: "db_b1", CreatedAt: t0, ExpiredAt: at(10)},
+			librarian.DB{Database: "db_x1", CreatedAt: *at(1), ExpiredAt: at(30)},
+			librarian.DB{Database: "db_x2", CreatedAt: *at(1), ExpiredAt: nil},
+		)},
+		{Name: "c", Database: newFakeShard(
+			librarian.DB{Database: "db_c1", CreatedAt: t0, ExpiredAt: at(20)},
+			librarian.DB{Database: "db_c2", CreatedAt: *at(2), ExpiredAt: at(10)},
+		)},
+		{Name: "d", Database: newFakeShard()},
+	}
+	s := newSharded(t, shards)
+
+	sorts := map[string][]librarian.Order{
+		"createdAt":            {{Field: librarian.SortCreatedAt, Desc: false}},
+		"-createdAt":           {{Field: librarian.SortCreatedAt, Desc: true}},
+		"expiredAt":            {{Field: librarian.SortExpiredAt, Desc: false}},
+		"-expiredAt,createdAt": {{Field: librarian.SortExpiredAt, Desc: true}, {Field: librarian.SortCreatedAt, Desc: false}},
+	}
+
+	for name, orders := range sorts {
+		all, err := s.List(ctx, librarian.WithSort(orders...))
+		if err != nil {
+			t.Fatalf("%s: List() error = %v", name, err)
+		}
+		if len(all) != 8 {
+			t.Fatalf("%s: List() returned %d DBs, want 8", name, len(all))
+		}
+		for i := 1; i < len(all); i++ {
+			if !librarian.Less(librarian.CursorOf(&all[i-1]), librarian.CursorOf(&all[i]), orders) {
+				t.Errorf("%s: %s goes before %s", name, all[i-1].Database, all[i].Database)
+			}
+		}
+
+		for size := 1; size <= len(all); size++ {
+			var (
+				got   []librarian.DB
+				after *librarian.Cursor
+			)
+
+			for page := 0; page <= len(all); page++ {
+				opts := []librarian.ListerOption{librarian.WithSort(orders...), librarian.WithLimit(size)}
+				if after != nil {
+					opts = append(opts, librarian.WithAfter(*after))
+				}
+
+				dbs, err := s.List(ctx, opts...)
+				if err != nil {
+					t.Fatalf("%s: List() error = %v", name, err)
+				}
+				if len(dbs) > size {
+					t.Fatalf("%s: page of size %d has %d DBs", name, size, len(dbs))
+				}
+				if len(dbs) == 0 {
+					break
+				}
+
+				got = append(got, dbs...)
+
+				cursor := librarian.CursorOf(&dbs[len(dbs)-1])
+				after = &cursor
+			}
+
+			if names(got) != names(all) {
+				t.Errorf("%s: pages of size %d = %s, want %s", name, size, names(got), names(all))
+			}
+		}
+	}
+}
+
+func names(dbs []librarian.DB) string {
+	s := ""
+	for i, db := range dbs {
+		if i > 0 {
+			s += ","
+		}
+		s += db.Database
+	}
+
+	return s
+}
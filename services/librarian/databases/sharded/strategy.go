@@ -0,0 +1,122 @@
+package sharded
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+// Strategy chooses a shard for a new DB.
+type Strategy interface {
+	// Place returns the index of the shard for the DB with the given database
+	// name.
+	Place(ctx context.Context, name string, shards []Shard) (int, error)
+}
+
+var _ Strategy = (*RoundRobin)(nil)
+
+// RoundRobin places DBs on shards in turn.
+type RoundRobin struct {
+	next uint64
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{
+		next: 0,
+	}
+}
+
+func (s *RoundRobin) Place(ctx context.Context, name string, shards []Shard) (int, error) {
+	n := atomic.AddUint64(&s.next, 1) - 1
+
+	return int(n % uint64(len(shards))), nil
+}
+
+var _ Strategy = (*LeastDatabases)(nil)
+
+// LeastDatabases places DBs on the shard with the least number of active DBs.
+type LeastDatabases struct{}
+
+func NewLeastDatabases() *LeastDatabases {
+	return &LeastDatabases{}
+}
+
+func (s *LeastDatabases) Place(ctx context.Context, name string, shards []Shard) (int, error) {
+	index := -1
+	least := 0
+
+	for i, shard := range shards {
+		count, err := shard.Database.Count(ctx, librarian.WithStatus(librarian.StatusActive))
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot count DBs of shard %s", shard.Name)
+		}
+
+		if index == -1 || count < least {
+			index = i
+			least = count
+		}
+	}
+
+	return index, nil
+}
+
+var _ Strategy = (*ConsistentHash)(nil)
+
+// ConsistentHash places DBs by the hash of their database names, so the same
+// name always goes to the same shard and adding a shard moves only a part of
+// names.
+type ConsistentHash struct {
+	replicas int
+}
+
+// NewConsistentHash returns the strategy with the given number of virtual
+// nodes per shard. Set `0` to use the default number.
+func NewConsistentHash(replicas int) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = 64
+	}
+
+	return &ConsistentHash{
+		replicas: replicas,
+	}
+}
+
+func (s *ConsistentHash) Place(ctx context.Context, name string, shards []Shard) (int, error) {
+	type node struct {
+		hash  uint32
+		index int
+	}
+
+	ring := make([]node, 0, len(shards)*s.replicas)
+	for i, shard := range shards {
+		for r := 0; r < s.replicas; r++ {
+			ring = append(ring, node{
+				hash:  hash(shard.Name + "#" + strconv.Itoa(r)),
+				index: i,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	h := hash(name)
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	if i == len(ring) {
+		i = 0
+	}
+
+	return ring[i].index, nil
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s)) // nolint:errcheck,gosec
+
+	return h.Sum32()
+}
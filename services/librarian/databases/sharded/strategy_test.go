@@ -0,0 +1,48 @@
+package sharded
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shardhub/shards/services/librarian"
+)
+
+func TestLeastDatabases(t *testing.T) {
+	now := time.Now()
+	shards := []Shard{
+		{Name: "a", Database: newFakeShard(librarian.DB{Database: "db-1", CreatedAt: now}, librarian.DB{Database: "db-2", CreatedAt: now})},
+		{Name: "b", Database: newFakeShard()},
+		{Name: "c", Database: newFakeShard(librarian.DB{Database: "db-3", CreatedAt: now})},
+	}
+
+	index, err := NewLeastDatabases().Place(context.Background(), "db-4", shards)
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	if index != 1 {
+		t.Errorf("Place() = %d, want 1", index)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	shards := []Shard{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	strategy := NewConsistentHash(0)
+
+	for _, name := range []string{"db-1", "db-2", "db-3"} {
+		first, err := strategy.Place(context.Background(), name, shards)
+		if err != nil {
+			t.Fatalf("Place(%s) error = %v", name, err)
+		}
+
+		// The shard doesn't depend on the order of shards
+		reversed := []Shard{shards[2], shards[1], shards[0]}
+		second, err := strategy.Place(context.Background(), name, reversed)
+		if err != nil {
+			t.Fatalf("Place(%s) error = %v", name, err)
+		}
+		if shards[first].Name != reversed[second].Name {
+			t.Errorf("Place(%s) = %s and %s after reordering", name, shards[first].Name, reversed[second].Name)
+		}
+	}
+}
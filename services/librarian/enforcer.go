@@ -0,0 +1,204 @@
+package librarian
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// QuotaLocker serializes checks of quotas of a tenant, so a check and the
+// change of DBs which was checked are atomic. Instances of the librarian must
+// share it, otherwise each of them enforces quotas on its own.
+type QuotaLocker interface {
+	// LockQuota blocks until the quota of the tenant is locked. Unlock must
+	// be called when the DB is changed.
+	LockQuota(ctx context.Context, tenant string) (unlock func(), err error)
+}
+
+// localQuotaLocker locks quotas of all tenants with one mutex, so it works
+// only inside a single instance of the librarian.
+type localQuotaLocker struct {
+	mu sync.Mutex
+}
+
+func (l *localQuotaLocker) LockQuota(ctx context.Context, tenant string) (func(), error) {
+	l.mu.Lock()
+
+	return l.mu.Unlock, nil
+}
+
+type EnforcerOption func(*Enforcer)
+
+// WithEnforcerLocker locks quotas with the locker. Without it, quotas are
+// locked only inside the process.
+func WithEnforcerLocker(locker QuotaLocker) EnforcerOption {
+	return func(o *Enforcer) { o.locker = locker }
+}
+
+// WithEnforcerClock sets the clock which tells how long DBs have left on
+// renewal. It's time.Now by default.
+func WithEnforcerClock(now func() time.Time) EnforcerOption {
+	return func(o *Enforcer) { o.now = now }
+}
+
+// Enforcer enforces quotas of DB owners. Usage of an owner is summed over all
+// databases of the librarian, so DBs on other backends or shards count too.
+// The quota stays locked until the DB is created or renewed.
+type Enforcer struct {
+	librarian *Librarian
+	quotas    *Quotas
+	locker    QuotaLocker
+	now       func() time.Time
+}
+
+func NewEnforcer(librarian *Librarian, quotas *Quotas, opts ...EnforcerOption) *Enforcer {
+	e := &Enforcer{
+		librarian: librarian,
+		quotas:    quotas,
+		locker:    &localQuotaLocker{mu: sync.Mutex{}},
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Usage sums the usage of the owner over all databases.
+func (e *Enforcer) Usage(ctx context.Context, owner string) (Usage, error) {
+	e.librarian.mu.RLock()
+	databases := make(map[string]Database, len(e.librarian.databases))
+	for name, database := range e.librarian.databases {
+		databases[name] = database
+	}
+	e.librarian.mu.RUnlock()
+
+	var usage Usage
+
+	for name, database := range databases {
+		u, err := database.Usage(ctx, owner)
+		if err != nil {
+			return Usage{}, errors.Wrapf(err, "cannot get usage of database %s", name)
+		}
+
+		usage.Databases += u.Databases
+		usage.DBTime += u.DBTime
+	}
+
+	return usage, nil
+}
+
+// Create creates a DB in the database if it fits into the quota of the owner
+// of options. DBs without an owner aren't limited.
+func (e *Enforcer) Create(ctx context.Context, database Database, opts ...CreaterOption) (*DB, error) {
+	options := NewCreaterOptions(opts...)
+
+	var db *DB
+
+	err := e.enforce(ctx, options.Owner, func(quota *Quota, usage Usage) error {
+		return quota.Check(options.Owner, usage, options.TTL)
+	}, func() error {
+		var err error
+		db, err = database.Create(ctx, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Clone clones the DB like Create creates a new one.
+func (e *Enforcer) Clone(ctx context.Context, database Database, id string, opts ...CreaterOption) (*DB, error) {
+	options := NewCreaterOptions(opts...)
+
+	var db *DB
+
+	err := e.enforce(ctx, options.Owner, func(quota *Quota, usage Usage) error {
+		return quota.Check(options.Owner, usage, options.TTL)
+	}, func() error {
+		var err error
+		db, err = database.Clone(ctx, id, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Renew renews the DB if it fits into the quota of its owner with the new
+// TTL instead of the time it has left.
+func (e *Enforcer) Renew(ctx context.Context, database Database, id string, ttl time.Duration) (*DB, error) {
+	db, err := database.Get(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get DB")
+	}
+
+	var renewed *DB
+
+	err = e.enforce(ctx, db.Owner, func(quota *Quota, usage Usage) error {
+		// NOTE: the DB could be renewed before the quota was locked.
+		current, err := database.Get(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "cannot get DB")
+		}
+
+		var left time.Duration
+		if now := e.now(); current.ExpiredAt != nil && current.Status(now) == StatusActive {
+			left = current.ExpiredAt.Sub(now)
+		}
+
+		return quota.CheckRenew(current.Owner, usage, left, ttl)
+	}, func() error {
+		var err error
+		renewed, err = database.Renew(ctx, id, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renewed, nil
+}
+
+// enforce locks the quota of the owner, checks it with its usage and calls
+// change unless the check fails. Owners with unlimited quotas aren't locked.
+func (e *Enforcer) enforce(
+	ctx context.Context,
+	owner string,
+	check func(quota *Quota, usage Usage) error,
+	change func() error,
+) error {
+	if owner == "" || e.quotas == nil {
+		return change()
+	}
+
+	quota := e.quotas.For(owner)
+	if *quota == (Quota{}) {
+		return change()
+	}
+
+	unlock, err := e.locker.LockQuota(ctx, owner)
+	if err != nil {
+		return errors.Wrap(err, "cannot lock quota")
+	}
+	defer unlock()
+
+	usage, err := e.Usage(ctx, owner)
+	if err != nil {
+		return errors.Wrap(err, "cannot check quota")
+	}
+
+	if err := check(quota, usage); err != nil {
+		return err
+	}
+
+	return change()
+}
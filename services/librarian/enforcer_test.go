@@ -0,0 +1,186 @@
+package librarian
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTestEnforcer(t *testing.T, quota Quota, databases ...Database) *Enforcer {
+	t.Helper()
+
+	l := New()
+	for i, database := range databases {
+		if err := l.Register(string(rune('a'+i)), database); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewEnforcer(l, &Quotas{Default: Quota{}, Tenants: map[string]Quota{"ci": quota}})
+}
+
+// quotaError returns the QuotaError of err or nil.
+func quotaError(err error) *QuotaError {
+	qerr, _ := errors.Cause(err).(*QuotaError)
+
+	return qerr
+}
+
+func TestEnforcerCreate(t *testing.T) {
+	ctx := context.Background()
+
+	a, b := newFakeDatabase(), newFakeDatabase()
+	enforcer := newTestEnforcer(t, Quota{MaxDatabases: 2, MaxTTL: 0, MaxDBHours: 0}, a, b)
+
+	// DBs of all databases count
+	for _, database := range []*fakeDatabase{a, b} {
+		if _, err := enforcer.Create(ctx, database, WithOwner("ci")); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	_, err := enforcer.Create(ctx, a, WithOwner("ci"))
+	want := &QuotaError{Tenant: "ci", Limit: LimitDatabases, Max: "2", PerDB: false}
+	if got := quotaError(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("Create() error = %v, want %v", err, want)
+	}
+
+	// Other tenants have the default quota
+	if _, err := enforcer.Create(ctx, a, WithOwner("qa")); err != nil {
+		t.Errorf("Create() of another tenant error = %v", err)
+	}
+	if _, err := enforcer.Create(ctx, a); err != nil {
+		t.Errorf("Create() without owner error = %v", err)
+	}
+}
+
+func TestEnforcerCreateConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	database := newFakeDatabase()
+	enforcer := newTestEnforcer(t, Quota{MaxDatabases: 3, MaxTTL: 0, MaxDBHours: 0}, database)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := enforcer.Create(ctx, database, WithOwner("ci")); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if created != 3 {
+		t.Errorf("%d DBs were created, want 3", created)
+	}
+}
+
+func TestEnforcerRenew(t *testing.T) {
+	ctx := context.Background()
+
+	database := newFakeDatabase()
+	enforcer := newTestEnforcer(t, Quota{MaxDatabases: 0, MaxTTL: 0, MaxDBHours: 2}, database)
+
+	long, err := enforcer.Create(ctx, database, WithOwner("ci"), WithTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	short, err := enforcer.Create(ctx, database, WithOwner("ci"), WithTTL(30*time.Minute))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		ttl  time.Duration
+		want *QuotaError
+	}{
+		{
+			// 1h30m - 1h + 1h29m
+			name: "fits",
+			id:   long.Database,
+			ttl:  89 * time.Minute,
+			want: nil,
+		},
+		{
+			// 1h59m - 30m + 1h
+			name: "exceeds DB-hours",
+			id:   short.Database,
+			ttl:  time.Hour,
+			want: &QuotaError{Tenant: "ci", Limit: LimitDBHours, Max: "2", PerDB: false},
+		},
+		{
+			name: "never fits",
+			id:   short.Database,
+			ttl:  3 * time.Hour,
+			want: &QuotaError{Tenant: "ci", Limit: LimitDBHours, Max: "2", PerDB: true},
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := enforcer.Renew(ctx, database, tt.id, tt.ttl)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: Renew() error = %v", tt.name, err)
+			}
+			continue
+		}
+
+		if got := quotaError(err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Renew() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if ttl := database.ttlOf(t, short.Database); ttl != 30*time.Minute {
+		t.Errorf("TTL of rejected renewal = %s, want 30m", ttl)
+	}
+}
+
+func TestEnforcerRenewClock(t *testing.T) {
+	ctx := context.Background()
+
+	database := newFakeDatabase()
+
+	l := New()
+	if err := l.Register("a", database); err != nil {
+		t.Fatal(err)
+	}
+
+	quotas := &Quotas{Default: Quota{MaxDatabases: 0, MaxTTL: 0, MaxDBHours: 1}, Tenants: nil}
+
+	db, err := NewEnforcer(l, quotas).Create(ctx, database, WithOwner("ci"), WithTTL(40*time.Minute))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The time DBs have left is replaced on renewal
+	if _, err := NewEnforcer(l, quotas).Renew(ctx, database, db.Database, 40*time.Minute); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+
+	// The DB has already expired by the clock of the enforcer, so nothing is
+	// replaced
+	later := func() time.Time { return time.Now().Add(50 * time.Minute) }
+
+	_, err = NewEnforcer(l, quotas, WithEnforcerClock(later)).Renew(ctx, database, db.Database, 40*time.Minute)
+	want := &QuotaError{Tenant: "ci", Limit: LimitDBHours, Max: "1", PerDB: false}
+	if got := quotaError(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("Renew() error = %v, want %v", err, want)
+	}
+}
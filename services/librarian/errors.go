@@ -0,0 +1,24 @@
+package librarian
+
+import (
+	"errors"
+)
+
+// Errors below are categories of errors returned by databases. Databases wrap
+// them with details, so use errors.Cause to compare.
+var (
+	// ErrNotFound is returned when a DB doesn't exist or was already deleted.
+	ErrNotFound = errors.New("librarian: not found") // nolint:gochecknoglobals
+	// ErrConflict is returned when a DB or a user with the same name already
+	// exists.
+	ErrConflict = errors.New("librarian: conflict") // nolint:gochecknoglobals
+	// ErrCapacity is returned when a backend is out of resources, e.g.
+	// connections or disk space.
+	ErrCapacity = errors.New("librarian: capacity exceeded") // nolint:gochecknoglobals
+	// ErrInvalidInput is returned when options can't be applied to a DB,
+	// e.g. TTL exceeds the maximum lifetime of a backend.
+	ErrInvalidInput = errors.New("librarian: invalid input") // nolint:gochecknoglobals
+	// ErrUnauthenticated is returned when a token is unknown, revoked or
+	// invalid.
+	ErrUnauthenticated = errors.New("librarian: unauthenticated") // nolint:gochecknoglobals
+)
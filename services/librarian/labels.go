@@ -0,0 +1,119 @@
+package librarian
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// labelKeyRe and labelValueRe match keys and values of labels. Values can be
+// empty, so labels can be used as flags.
+var (
+	labelKeyRe   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`) // nolint:gochecknoglobals
+	labelValueRe = regexp.MustCompile(`^[A-Za-z0-9._/-]{0,255}$`)                         // nolint:gochecknoglobals
+)
+
+// MaxLabels is the maximum number of labels of a DB.
+const MaxLabels = 32
+
+// ValidateLabels checks keys and values of labels. It returns ErrInvalidInput
+// if any of them is invalid.
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return errors.Wrapf(ErrInvalidInput, "DB can't have more than %d labels", MaxLabels)
+	}
+
+	for key, value := range labels {
+		if !labelKeyRe.MatchString(key) {
+			return errors.Wrapf(ErrInvalidInput, "label key %q must be from 1 to 63 characters: letters, digits, ., _, / and -", key)
+		}
+		if !labelValueRe.MatchString(value) {
+			return errors.Wrapf(ErrInvalidInput, "value of label %s must be up to 255 characters: letters, digits, ., _, / and -", key)
+		}
+	}
+
+	return nil
+}
+
+type Operator string
+
+const (
+	// OperatorEquals matches DBs with the label equal to the value
+	OperatorEquals Operator = "="
+	// OperatorNotEquals matches DBs without the label or with another value
+	OperatorNotEquals Operator = "!="
+)
+
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Value    string
+}
+
+// Selector matches DBs whose labels meet all requirements. Empty selector
+// matches all DBs.
+type Selector []Requirement
+
+// ParseSelector parses requirements separated by commas, e.g.
+// "repo=shards,branch!=master". Every key can be used once. It returns
+// ErrInvalidInput if the selector is invalid.
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+
+	keys := make(map[string]bool)
+
+	for _, part := range strings.Split(s, ",") {
+		var r Requirement
+
+		if i := strings.Index(part, string(OperatorNotEquals)); i >= 0 {
+			r = Requirement{Key: part[:i], Operator: OperatorNotEquals, Value: part[i+len(OperatorNotEquals):]}
+		} else if i := strings.Index(part, string(OperatorEquals)); i >= 0 {
+			r = Requirement{Key: part[:i], Operator: OperatorEquals, Value: part[i+len(OperatorEquals):]}
+		} else {
+			return nil, errors.Wrapf(ErrInvalidInput, "requirement %q must be key=value or key!=value", part)
+		}
+
+		r.Key = strings.TrimSpace(r.Key)
+		r.Value = strings.TrimSpace(r.Value)
+
+		if !labelKeyRe.MatchString(r.Key) {
+			return nil, errors.Wrapf(ErrInvalidInput, "label key %q is invalid", r.Key)
+		}
+		if !labelValueRe.MatchString(r.Value) {
+			return nil, errors.Wrapf(ErrInvalidInput, "value of label %s is invalid", r.Key)
+		}
+		if keys[r.Key] {
+			return nil, errors.Wrapf(ErrInvalidInput, "label key %s is used more than once", r.Key)
+		}
+
+		keys[r.Key] = true
+		selector = append(selector, r)
+	}
+
+	return selector, nil
+}
+
+// Matches returns true if labels meet all requirements.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.Key]
+
+		switch r.Operator {
+		case OperatorEquals:
+			if !ok || value != r.Value {
+				return false
+			}
+		case OperatorNotEquals:
+			if ok && value == r.Value {
+				return false
+			}
+		}
+	}
+
+	return true
+}
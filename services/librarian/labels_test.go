@@ -0,0 +1,152 @@
+package librarian
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Selector
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			s:    "",
+			want: nil,
+		},
+		{
+			name: "blank",
+			s:    "  ",
+			want: nil,
+		},
+		{
+			name: "equals",
+			s:    "repo=shards",
+			want: Selector{{Key: "repo", Operator: OperatorEquals, Value: "shards"}},
+		},
+		{
+			name: "not equals",
+			s:    "branch!=master",
+			want: Selector{{Key: "branch", Operator: OperatorNotEquals, Value: "master"}},
+		},
+		{
+			name: "several requirements",
+			s:    "repo=shards, branch != master,pipeline=42",
+			want: Selector{
+				{Key: "repo", Operator: OperatorEquals, Value: "shards"},
+				{Key: "branch", Operator: OperatorNotEquals, Value: "master"},
+				{Key: "pipeline", Operator: OperatorEquals, Value: "42"},
+			},
+		},
+		{
+			name: "empty value",
+			s:    "flag=",
+			want: Selector{{Key: "flag", Operator: OperatorEquals, Value: ""}},
+		},
+		{
+			name: "key with dots and slashes",
+			s:    "shardhub.io/team=core",
+			want: Selector{{Key: "shardhub.io/team", Operator: OperatorEquals, Value: "core"}},
+		},
+		{
+			name:    "without operator",
+			s:       "repo",
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			s:       "=shards",
+			wantErr: true,
+		},
+		{
+			name:    "empty requirement",
+			s:       "repo=shards,",
+			wantErr: true,
+		},
+		{
+			name:    "invalid key",
+			s:       "-repo=shards",
+			wantErr: true,
+		},
+		{
+			name:    "too long key",
+			s:       strings.Repeat("k", 64) + "=v",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			s:       "repo=sha rds",
+			wantErr: true,
+		},
+		{
+			name:    "another operator in value",
+			s:       "repo=a=b",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate key",
+			s:       "repo=shards,repo=librarian",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate key with another operator",
+			s:       "repo=shards,repo!=librarian",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSelector(tt.s)
+
+			if tt.wantErr {
+				if errors.Cause(err) != ErrInvalidInput {
+					t.Errorf("ParseSelector(%q) = %v, %v, want %v", tt.s, got, err, ErrInvalidInput)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseSelector(%q) error = %v", tt.s, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSelector(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	selector := Selector{
+		{Key: "repo", Operator: OperatorEquals, Value: "shards"},
+		{Key: "branch", Operator: OperatorNotEquals, Value: "master"},
+	}
+
+	tests := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{labels: map[string]string{"repo": "shards", "branch": "dev"}, want: true},
+		{labels: map[string]string{"repo": "shards"}, want: true},
+		{labels: map[string]string{"repo": "shards", "branch": "master"}, want: false},
+		{labels: map[string]string{"repo": "librarian"}, want: false},
+		{labels: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := selector.Matches(tt.labels); got != tt.want {
+			t.Errorf("Matches(%v) = %t, want %t", tt.labels, got, tt.want)
+		}
+	}
+
+	if !(Selector{}).Matches(nil) {
+		t.Error("empty selector doesn't match DBs without labels")
+	}
+}
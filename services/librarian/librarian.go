@@ -52,7 +52,47 @@ func (l *Librarian) Databases() []string {
 	return list
 }
 
+// Ping pings registered databases which implement Pinger concurrently and
+// returns errors by their names. Databases without errors are omitted.
+func (l *Librarian) Ping(ctx context.Context) map[string]error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make(map[string]error)
+	)
+
+	for name, database := range l.databases {
+		pinger, ok := database.(Pinger)
+		if !ok {
+			continue
+		}
+
+		name := name
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := pinger.Ping(ctx); err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
 func (l *Librarian) Get(name string) Database {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	database, ok := l.databases[name]
 	if !ok {
 		return nil
@@ -60,19 +100,84 @@ func (l *Librarian) Get(name string) Database {
 	return database
 }
 
+type Status string
+
+const (
+	StatusActive  Status = "active"
+	StatusExpired Status = "expired"
+	StatusDeleted Status = "deleted"
+)
+
 type DB struct {
-	Database  string
-	Username  string
+	Database string
+	// Owner is the tenant who created the DB, empty if unknown
+	Owner string
+	// Labels are arbitrary metadata, e.g. repo=shards
+	Labels map[string]string
+	// Username of the user who was created with the DB
+	Username string
+	// Password is known only right after creation
 	Password  string
+	Users     []User
+	CreatedAt time.Time
+	ExpiredAt *time.Time
+	DeletedAt *time.Time
+}
+
+// Status returns the status of the DB at the given time.
+func (db *DB) Status(now time.Time) Status {
+	if db.DeletedAt != nil {
+		return StatusDeleted
+	}
+	if db.ExpiredAt != nil && !db.ExpiredAt.After(now) {
+		return StatusExpired
+	}
+	return StatusActive
+}
+
+// Role is a profile of privileges of a user in a DB.
+type Role string
+
+const (
+	// RoleOwner can create objects and has all privileges on objects of other
+	// owners
+	RoleOwner Role = "owner"
+	// RoleReadWrite can read and modify data, but can't change the schema
+	RoleReadWrite Role = "readwrite"
+	// RoleReadOnly can only read data
+	RoleReadOnly Role = "readonly"
+)
+
+type User struct {
+	Username string
+	// Password is known only right after creation
+	Password string
+	Role     Role
+	// ExpiredAt is set for short-lived credentials
 	ExpiredAt *time.Time
 }
 
+// Migration is a named SQL script which is applied to a new DB.
+type Migration struct {
+	Name string
+	SQL  string
+}
+
 type CreaterOptions struct {
 	Database string
 	Username string
 	Password *string
 	// Set `0` if without TTL
-	TTL               time.Duration
+	TTL time.Duration
+	// Set empty if without template, backends allow only known templates
+	Template string
+	// Migrations are applied in order, backends may cache the result
+	Migrations []Migration
+	// Set empty if the DB doesn't belong to a tenant
+	Owner string
+	// Set nil if without labels
+	Labels map[string]string
+
 	DBNameGenerator   func() string
 	UsernameGenerator func() string
 	PasswordGenerator func() string
@@ -96,6 +201,23 @@ func WithTTL(ttl time.Duration) CreaterOption {
 	return func(o *CreaterOptions) { o.TTL = ttl }
 }
 
+func WithTemplate(template string) CreaterOption {
+	return func(o *CreaterOptions) { o.Template = template }
+}
+
+func WithMigrations(migrations ...Migration) CreaterOption {
+	return func(o *CreaterOptions) { o.Migrations = migrations }
+}
+
+func WithOwner(owner string) CreaterOption {
+	return func(o *CreaterOptions) { o.Owner = owner }
+}
+
+// WithLabels sets labels of the DB, see ValidateLabels.
+func WithLabels(labels map[string]string) CreaterOption {
+	return func(o *CreaterOptions) { o.Labels = labels }
+}
+
 // TODO: Maybe we will add it later.
 // func WithoutTTL() CreaterOption {
 // 	return func(o *CreaterOptions) { o.TTL = 0 }
@@ -105,18 +227,184 @@ type Creator interface {
 	Create(ctx context.Context, opts ...CreaterOption) (*DB, error)
 }
 
+type ListerOptions struct {
+	// Set empty to list DBs in any status
+	Status Status
+	// Set empty to list DBs of all tenants
+	Owner string
+	// Set empty to list DBs with any labels
+	Selector Selector
+	// DBs are sorted by the fields in order, then by names
+	Sort []Order
+	// Set nil to list from the beginning
+	After *Cursor
+	// Set `0` to list all DBs
+	Limit int
+}
+
+type ListerOption func(*ListerOptions)
+
+func WithStatus(status Status) ListerOption {
+	return func(o *ListerOptions) { o.Status = status }
+}
+
+// WithOwnedBy lists only DBs of the tenant.
+func WithOwnedBy(owner string) ListerOption {
+	return func(o *ListerOptions) { o.Owner = owner }
+}
+
+// WithSelector lists only DBs whose labels match the selector.
+func WithSelector(selector Selector) ListerOption {
+	return func(o *ListerOptions) { o.Selector = selector }
+}
+
+func WithSort(orders ...Order) ListerOption {
+	return func(o *ListerOptions) { o.Sort = orders }
+}
+
+// WithAfter lists DBs which go after the cursor in the order, see CursorOf.
+func WithAfter(cursor Cursor) ListerOption {
+	return func(o *ListerOptions) { o.After = &cursor }
+}
+
+func WithLimit(limit int) ListerOption {
+	return func(o *ListerOptions) { o.Limit = limit }
+}
+
+func NewListerOptions(opts ...ListerOption) *ListerOptions {
+	options := &ListerOptions{
+		Status:   "",
+		Owner:    "",
+		Selector: nil,
+		Sort:     DefaultSort,
+		After:    nil,
+		Limit:    0,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
 type Lister interface {
-	List(ctx context.Context) ([]DB, error)
+	List(ctx context.Context, opts ...ListerOption) ([]DB, error)
+}
+
+// Counter returns the number of DBs which match lister options without
+// listing them. Sort, cursor and limit are ignored.
+type Counter interface {
+	Count(ctx context.Context, opts ...ListerOption) (int, error)
 }
 
 type Deleter interface {
 	DeleteExpired(ctx context.Context) ([]DB, error)
+	// DeleteExpiredUsers deletes expired users of DBs which are still alive.
+	// Returned DBs contain only deleted users.
+	DeleteExpiredUsers(ctx context.Context) ([]DB, error)
+}
+
+// Renewer changes expiration time of a DB: the DB will expire in ttl from now.
+type Renewer interface {
+	Renew(ctx context.Context, id string, ttl time.Duration) (*DB, error)
+}
+
+// Dropper deletes a single DB with all its users regardless of its TTL.
+type Dropper interface {
+	Delete(ctx context.Context, id string) error
+}
+
+// Getter returns a single DB by its ID, i.e. by its database name.
+type Getter interface {
+	Get(ctx context.Context, id string) (*DB, error)
+}
+
+// Assigner hands a DB out, e.g. a pre-created one: it sets the owner and
+// labels of options. Other options are ignored.
+type Assigner interface {
+	Assign(ctx context.Context, id string, opts ...CreaterOption) (*DB, error)
+}
+
+// Cloner creates a new DB as a copy of an existing one with its own user,
+// password and TTL. Template and migrations can't be used with clone.
+type Cloner interface {
+	Clone(ctx context.Context, id string, opts ...CreaterOption) (*DB, error)
+}
+
+type UserOptions struct {
+	Username string
+	Password *string
+	Role     Role
+	// Set `0` if the user lives as long as the DB
+	TTL time.Duration
+
+	UsernameGenerator func() string
+	PasswordGenerator func() string
+}
+
+type UserOption func(*UserOptions)
+
+func WithUserUsername(username string) UserOption {
+	return func(o *UserOptions) { o.Username = username }
+}
+
+func WithUserPassword(password string) UserOption {
+	return func(o *UserOptions) { o.Password = &password }
+}
+
+func WithRole(role Role) UserOption {
+	return func(o *UserOptions) { o.Role = role }
+}
+
+// WithUserTTL makes short-lived credentials: the user can't log in after TTL
+// and is deleted by the reaper.
+func WithUserTTL(ttl time.Duration) UserOption {
+	return func(o *UserOptions) { o.TTL = ttl }
+}
+
+func NewUserOptions(opts ...UserOption) *UserOptions {
+	options := &UserOptions{
+		Username:          "",
+		Password:          nil,
+		Role:              RoleReadWrite,
+		TTL:               0,
+		UsernameGenerator: GenerateUsername,
+		PasswordGenerator: GeneratePassword,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return options
+}
+
+// UserManager adds users with a role to an existing DB and deletes them. The
+// last owner of a DB can't be deleted.
+type UserManager interface {
+	CreateUser(ctx context.Context, id string, opts ...UserOption) (*User, error)
+	DeleteUser(ctx context.Context, id, username string) error
+}
+
+// Pinger checks that a database is connected and can serve requests.
+// Databases may implement it, others are considered always available.
+type Pinger interface {
+	Ping(ctx context.Context) error
 }
 
 type Database interface {
 	Creator
+	Getter
 	Lister
+	Counter
+	Usager
 	Deleter
+	Renewer
+	Dropper
+	Cloner
+	UserManager
+	Assigner
 }
 
 func NewCreaterOptions(opts ...CreaterOption) *CreaterOptions {
@@ -125,6 +413,10 @@ func NewCreaterOptions(opts ...CreaterOption) *CreaterOptions {
 		Username:          "",
 		Password:          nil,
 		TTL:               10 * time.Minute,
+		Template:          "",
+		Migrations:        nil,
+		Owner:             "",
+		Labels:            nil,
 		DBNameGenerator:   GenerateDBName,
 		UsernameGenerator: GenerateUsername,
 		PasswordGenerator: GeneratePassword,
@@ -0,0 +1,85 @@
+package librarian
+
+import (
+	"time"
+)
+
+// SortField is a field of DBs which lists can be sorted by.
+type SortField string
+
+const (
+	SortCreatedAt SortField = "createdAt"
+	// DBs without TTL are the last in ascending order
+	SortExpiredAt SortField = "expiredAt"
+)
+
+// Order sorts DBs by the field. DBs with equal fields are sorted by their
+// names, so the order is stable.
+type Order struct {
+	Field SortField
+	Desc  bool
+}
+
+// DefaultSort lists the oldest DBs first.
+// nolint:gochecknoglobals
+var DefaultSort = []Order{{Field: SortCreatedAt, Desc: false}}
+
+// Cursor is the position of a DB in a sorted list. It holds all fields which
+// lists can be sorted by, so it can be used with any order.
+type Cursor struct {
+	Database  string
+	CreatedAt time.Time
+	ExpiredAt *time.Time
+}
+
+// CursorOf returns the cursor pointing to the DB, lists continue after it.
+func CursorOf(db *DB) Cursor {
+	return Cursor{
+		Database:  db.Database,
+		CreatedAt: db.CreatedAt,
+		ExpiredAt: db.ExpiredAt,
+	}
+}
+
+// Less reports whether the DB at cursor a goes before the DB at cursor b in
+// the order. Names are compared bytewise.
+func Less(a, b Cursor, orders []Order) bool {
+	for _, o := range orders {
+		c := 0
+
+		switch o.Field {
+		case SortCreatedAt:
+			c = compareTimes(&a.CreatedAt, &b.CreatedAt)
+		case SortExpiredAt:
+			c = compareTimes(a.ExpiredAt, b.ExpiredAt)
+		}
+
+		if o.Desc {
+			c = -c
+		}
+
+		if c != 0 {
+			return c < 0
+		}
+	}
+
+	return a.Database < b.Database
+}
+
+// compareTimes compares times, nil is greater than any time.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	default:
+		return 0
+	}
+}
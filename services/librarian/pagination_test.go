@@ -0,0 +1,105 @@
+package librarian
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLess(t *testing.T) {
+	t0 := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+
+	var (
+		createdAt     = []Order{{Field: SortCreatedAt, Desc: false}}
+		createdAtDesc = []Order{{Field: SortCreatedAt, Desc: true}}
+		expiredAt     = []Order{{Field: SortExpiredAt, Desc: false}}
+		expiredAtDesc = []Order{{Field: SortExpiredAt, Desc: true}}
+	)
+
+	tests := []struct {
+		name   string
+		a, b   Cursor
+		orders []Order
+		want   bool
+	}{
+		{
+			name:   "older first",
+			a:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_a", CreatedAt: t1, ExpiredAt: nil},
+			orders: createdAt,
+			want:   true,
+		},
+		{
+			name:   "newer first",
+			a:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_a", CreatedAt: t1, ExpiredAt: nil},
+			orders: createdAtDesc,
+			want:   false,
+		},
+		{
+			name:   "equal createdAt by name",
+			a:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: nil},
+			orders: createdAt,
+			want:   true,
+		},
+		{
+			name:   "equal createdAt by name in descending order",
+			a:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: nil},
+			orders: createdAtDesc,
+			want:   true,
+		},
+		{
+			name:   "names are compared bytewise",
+			a:      Cursor{Database: "DB_b", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: nil},
+			orders: createdAt,
+			want:   true,
+		},
+		{
+			name:   "same DB",
+			a:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: nil},
+			orders: createdAt,
+			want:   false,
+		},
+		{
+			name:   "without TTL last",
+			a:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: &t1},
+			b:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: nil},
+			orders: expiredAt,
+			want:   true,
+		},
+		{
+			name:   "without TTL first in descending order",
+			a:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: nil},
+			b:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: &t1},
+			orders: expiredAtDesc,
+			want:   true,
+		},
+		{
+			name:   "both without TTL by name",
+			a:      Cursor{Database: "db_a", CreatedAt: t1, ExpiredAt: nil},
+			b:      Cursor{Database: "db_b", CreatedAt: t0, ExpiredAt: nil},
+			orders: expiredAt,
+			want:   true,
+		},
+		{
+			name:   "second order breaks the tie",
+			a:      Cursor{Database: "db_b", CreatedAt: t1, ExpiredAt: &t1},
+			b:      Cursor{Database: "db_a", CreatedAt: t0, ExpiredAt: &t1},
+			orders: []Order{{Field: SortExpiredAt, Desc: false}, {Field: SortCreatedAt, Desc: true}},
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Less(tt.a, tt.b, tt.orders); got != tt.want {
+				t.Errorf("Less() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package librarian
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var _ Database = (*Pool)(nil)
+
+type PoolOption func(*Pool)
+
+func WithPoolSize(size int) PoolOption {
+	return func(o *Pool) { o.size = size }
+}
+
+// WithPoolIdleTTL sets TTL of DBs waiting in the pool. The pool forgets them
+// on restart, so the reaper deletes them when they expire.
+func WithPoolIdleTTL(ttl time.Duration) PoolOption {
+	return func(o *Pool) { o.idleTTL = ttl }
+}
+
+// WithPoolRefillInterval sets how often the pool retries to refill itself
+// after an error.
+func WithPoolRefillInterval(interval time.Duration) PoolOption {
+	return func(o *Pool) { o.refillInterval = interval }
+}
+
+func WithPoolLogger(logger *zap.Logger) PoolOption {
+	return func(o *Pool) { o.logger = logger }
+}
+
+type PoolStats struct {
+	Hits   uint64
+	Misses uint64
+	Ready  int
+}
+
+// Pool keeps pre-created DBs of a database and hands them out on Create, so
+// users don't wait for the database. DBs with a custom name, username,
+// password, template or migrations can't be taken from the pool and are
+// created as usual. Pooled DBs are assigned to the owner when they are handed
+// out.
+//
+// Pooled DBs are regular DBs with a short TTL, so they are shown by List.
+type Pool struct {
+	Database
+
+	size           int
+	idleTTL        time.Duration
+	refillInterval time.Duration
+	logger         *zap.Logger
+
+	ready  chan *DB
+	refill chan struct{}
+
+	hits   uint64
+	misses uint64
+}
+
+func NewPool(database Database, opts ...PoolOption) *Pool {
+	p := &Pool{
+		Database: database,
+
+		size:           1,
+		idleTTL:        time.Hour,
+		refillInterval: 10 * time.Second,
+		logger:         zap.NewNop(),
+
+		ready:  nil,
+		refill: make(chan struct{}, 1),
+
+		hits:   0,
+		misses: 0,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	p.ready = make(chan *DB, p.size)
+
+	return p
+}
+
+// Run keeps the pool full until ctx is done and then deletes pooled DBs.
+func (p *Pool) Run(ctx context.Context) error {
+	for {
+		p.fill(ctx)
+
+		timer := time.NewTimer(p.refillInterval)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			p.drain()
+
+			return nil
+
+		case <-p.refill:
+			timer.Stop()
+
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *Pool) Create(ctx context.Context, opts ...CreaterOption) (*DB, error) {
+	options := NewCreaterOptions(opts...)
+
+	if options.Database == "" && options.Username == "" && options.Password == nil &&
+		options.Template == "" && len(options.Migrations) == 0 && options.TTL != 0 {
+		if db := p.take(ctx, options, opts); db != nil {
+			atomic.AddUint64(&p.hits, 1)
+
+			return db, nil
+		}
+	}
+
+	atomic.AddUint64(&p.misses, 1)
+
+	return p.Database.Create(ctx, opts...)
+}
+
+// Ping pings the database if it implements Pinger.
+func (p *Pool) Ping(ctx context.Context) error {
+	if pinger, ok := p.Database.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Hits:   atomic.LoadUint64(&p.hits),
+		Misses: atomic.LoadUint64(&p.misses),
+		Ready:  len(p.ready),
+	}
+}
+
+// take returns a pooled DB renewed with TTL of options and assigned to the
+// owner with labels of options or nil if the pool is empty.
+func (p *Pool) take(ctx context.Context, options *CreaterOptions, opts []CreaterOption) *DB {
+	for {
+		var db *DB
+
+		select {
+		case db = <-p.ready:
+		default:
+			return nil
+		}
+
+		p.signalRefill()
+
+		res, err := p.Database.Renew(ctx, db.Database, options.TTL)
+		if err != nil {
+			// NOTE: the DB could expire or TTL could exceed the maximum
+			// lifetime. It will be deleted by the reaper anyway.
+			p.logger.Warn("Cannot renew pooled DB", zap.String("db", db.Database), zap.Error(err))
+
+			if errors.Cause(err) == ErrNotFound {
+				continue
+			}
+
+			p.giveBack(ctx, db)
+
+			return nil
+		}
+
+		if options.Owner != "" || len(options.Labels) > 0 {
+			res, err = p.Database.Assign(ctx, db.Database, opts...)
+			if err != nil {
+				p.logger.Warn("Cannot assign pooled DB", zap.String("db", db.Database), zap.Error(err))
+
+				p.giveBack(ctx, db)
+
+				return nil
+			}
+		}
+
+		res.Password = db.Password
+
+		return res
+	}
+}
+
+// giveBack returns a DB which was taken, but can't be handed out, to the pool
+// with the idle TTL. The DB is deleted if the pool is already full, so it
+// doesn't live with TTL of options.
+func (p *Pool) giveBack(ctx context.Context, db *DB) {
+	_, err := p.Database.Renew(ctx, db.Database, p.idleTTL)
+	switch {
+	case err == nil:
+		select {
+		case p.ready <- db:
+			return
+		default:
+		}
+	case errors.Cause(err) == ErrNotFound:
+		return
+	default:
+		p.logger.Warn("Cannot renew pooled DB", zap.String("db", db.Database), zap.Error(err))
+	}
+
+	if err := p.Database.Delete(ctx, db.Database); err != nil {
+		p.logger.Error("Cannot delete pooled DB", zap.String("db", db.Database), zap.Error(err))
+	}
+}
+
+func (p *Pool) fill(ctx context.Context) {
+	created := 0
+
+	for len(p.ready) < p.size {
+		db, err := p.Database.Create(ctx, WithTTL(p.idleTTL))
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error("Cannot create pooled DB", zap.Error(err))
+			}
+			break
+		}
+
+		select {
+		case p.ready <- db:
+			created++
+			continue
+		case <-ctx.Done():
+		default:
+			// NOTE: DBs were given back while this one was created, so the
+			// pool is already full.
+		}
+
+		p.discard(db)
+
+		break
+	}
+
+	if created > 0 {
+		stats := p.Stats()
+
+		p.logger.Info("Pool was refilled",
+			zap.Int("created", created),
+			zap.Int("ready", stats.Ready),
+			zap.Uint64("hits", stats.Hits),
+			zap.Uint64("misses", stats.Misses),
+		)
+	}
+}
+
+// discard deletes a DB which doesn't fit in the pool. ctx of Run can be done,
+// so it uses a new one.
+func (p *Pool) discard(db *DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := p.Database.Delete(ctx, db.Database); err != nil {
+		p.logger.Error("Cannot delete pooled DB", zap.String("db", db.Database), zap.Error(err))
+	}
+}
+
+func (p *Pool) drain() {
+	// NOTE: ctx of Run is already done, so we need a new one.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for {
+		select {
+		case db := <-p.ready:
+			if err := p.Database.Delete(ctx, db.Database); err != nil {
+				p.logger.Error("Cannot delete pooled DB", zap.String("db", db.Database), zap.Error(err))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *Pool) signalRefill() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
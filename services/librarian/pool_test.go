@@ -0,0 +1,345 @@
+package librarian
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeDatabase keeps DBs in memory. Methods which aren't used by tests panic.
+type fakeDatabase struct {
+	Database
+
+	mu        sync.Mutex
+	dbs       map[string]DB
+	assignErr error
+}
+
+func newFakeDatabase() *fakeDatabase {
+	return &fakeDatabase{
+		Database: nil,
+
+		mu:        sync.Mutex{},
+		dbs:       make(map[string]DB),
+		assignErr: nil,
+	}
+}
+
+func (f *fakeDatabase) Create(ctx context.Context, opts ...CreaterOption) (*DB, error) {
+	options := NewCreaterOptions(opts...)
+
+	name := options.Database
+	if name == "" {
+		name = options.DBNameGenerator()
+	}
+
+	now := time.Now()
+	db := DB{
+		Database:  name,
+		Owner:     options.Owner,
+		Labels:    options.Labels,
+		Password:  options.PasswordGenerator(),
+		CreatedAt: now,
+	}
+	if options.TTL != 0 {
+		expiredAt := now.Add(options.TTL)
+		db.ExpiredAt = &expiredAt
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.dbs[name] = db
+
+	return &db, nil
+}
+
+func (f *fakeDatabase) Get(ctx context.Context, id string) (*DB, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	db, ok := f.dbs[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "DB %s does not exist", id)
+	}
+
+	return &db, nil
+}
+
+func (f *fakeDatabase) Renew(ctx context.Context, id string, ttl time.Duration) (*DB, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	db, ok := f.dbs[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "DB %s does not exist", id)
+	}
+
+	expiredAt := time.Now().Add(ttl)
+	db.ExpiredAt = &expiredAt
+	f.dbs[id] = db
+
+	return &db, nil
+}
+
+func (f *fakeDatabase) Assign(ctx context.Context, id string, opts ...CreaterOption) (*DB, error) {
+	options := NewCreaterOptions(opts...)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.assignErr != nil {
+		return nil, f.assignErr
+	}
+
+	db, ok := f.dbs[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "DB %s does not exist", id)
+	}
+
+	db.Owner = options.Owner
+	db.Labels = options.Labels
+	f.dbs[id] = db
+
+	return &db, nil
+}
+
+func (f *fakeDatabase) Delete(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.dbs[id]; !ok {
+		return errors.Wrapf(ErrNotFound, "DB %s does not exist", id)
+	}
+
+	delete(f.dbs, id)
+
+	return nil
+}
+
+func (f *fakeDatabase) Usage(ctx context.Context, owner string) (Usage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var usage Usage
+
+	now := time.Now()
+	for _, db := range f.dbs {
+		if db.Owner != owner || db.Status(now) != StatusActive {
+			continue
+		}
+
+		usage.Databases++
+		if db.ExpiredAt != nil {
+			usage.DBTime += db.ExpiredAt.Sub(now)
+		}
+	}
+
+	return usage, nil
+}
+
+func (f *fakeDatabase) ttlOf(t *testing.T, id string) time.Duration {
+	t.Helper()
+
+	db, err := f.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", id, err)
+	}
+
+	return time.Until(*db.ExpiredAt).Round(time.Minute)
+}
+
+func TestPoolTake(t *testing.T) {
+	ctx := context.Background()
+
+	database := newFakeDatabase()
+	pool := NewPool(database, WithPoolSize(1), WithPoolIdleTTL(time.Hour))
+	pool.fill(ctx)
+
+	db, err := pool.Create(ctx, WithTTL(30*time.Minute), WithOwner("ci"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if db.Owner != "ci" {
+		t.Errorf("owner = %q, want ci", db.Owner)
+	}
+	if ttl := database.ttlOf(t, db.Database); ttl != 30*time.Minute {
+		t.Errorf("TTL = %s, want 30m", ttl)
+	}
+	if stats := pool.Stats(); stats.Hits != 1 || stats.Ready != 0 {
+		t.Errorf("stats = %+v, want 1 hit and 0 ready", stats)
+	}
+}
+
+func TestPoolTakeFailedAssign(t *testing.T) {
+	ctx := context.Background()
+
+	database := newFakeDatabase()
+	pool := NewPool(database, WithPoolSize(1), WithPoolIdleTTL(time.Hour))
+	pool.fill(ctx)
+
+	// NOTE: peek at the pooled DB.
+	pooled := <-pool.ready
+	pool.ready <- pooled
+
+	database.assignErr = &QuotaError{Tenant: "ci", Limit: LimitDatabases, Max: "1", PerDB: false}
+
+	opts := []CreaterOption{WithTTL(30 * time.Minute), WithOwner("ci")}
+	if db := pool.take(ctx, NewCreaterOptions(opts...), opts); db != nil {
+		t.Fatalf("take() = %s, want nil", db.Database)
+	}
+
+	// The DB is back in the pool with the idle TTL
+	if stats := pool.Stats(); stats.Ready != 1 {
+		t.Fatalf("%d DBs are ready, want 1", stats.Ready)
+	}
+	if ttl := database.ttlOf(t, pooled.Database); ttl != time.Hour {
+		t.Errorf("TTL = %s, want 1h", ttl)
+	}
+
+	// The DB is deleted if the pool was refilled in the meantime
+	<-pool.ready
+	pool.ready <- &DB{Database: "db_refilled"}
+
+	pool.giveBack(ctx, pooled)
+
+	if _, err := database.Get(ctx, pooled.Database); errors.Cause(err) != ErrNotFound {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+// racingDatabase runs the hook after every Create, e.g. to give DBs back to
+// the pool while it's filled.
+type racingDatabase struct {
+	*fakeDatabase
+
+	hook func()
+}
+
+func (d *racingDatabase) Create(ctx context.Context, opts ...CreaterOption) (*DB, error) {
+	db, err := d.fakeDatabase.Create(ctx, opts...)
+	if err == nil && d.hook != nil {
+		d.hook()
+	}
+
+	return db, err
+}
+
+func (f *fakeDatabase) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.dbs))
+	for name := range f.dbs {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func TestPoolFillGivenBack(t *testing.T) {
+	ctx := context.Background()
+
+	database := &racingDatabase{fakeDatabase: newFakeDatabase(), hook: nil}
+	pool := NewPool(database, WithPoolSize(1), WithPoolIdleTTL(time.Hour))
+
+	// A DB is given back while the pool creates one
+	var given *DB
+	database.hook = func() {
+		database.hook = nil
+
+		var err error
+		if given, err = database.fakeDatabase.Create(ctx, WithTTL(time.Minute)); err != nil {
+			t.Error(err)
+			return
+		}
+		pool.giveBack(ctx, given)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pool.fill(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fill() is blocked by the full pool")
+	}
+
+	// The created DB is deleted and the given back one is kept
+	if names := database.names(); len(names) != 1 || names[0] != given.Database {
+		t.Errorf("DBs = %v, want only %s", names, given.Database)
+	}
+	if db := <-pool.ready; db.Database != given.Database {
+		t.Errorf("pooled DB = %s, want %s", db.Database, given.Database)
+	}
+}
+
+func TestPoolRunShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		// canceled cancels ctx of Run while the pool creates a DB and is
+		// already full
+		canceled bool
+	}{
+		{name: "full pool", canceled: false},
+		{name: "canceled while full", canceled: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			database := &racingDatabase{fakeDatabase: newFakeDatabase(), hook: nil}
+			pool := NewPool(database, WithPoolSize(2), WithPoolRefillInterval(time.Hour))
+
+			if tt.canceled {
+				database.hook = func() {
+					if len(pool.ready) == 1 {
+						database.hook = nil
+
+						db, err := database.fakeDatabase.Create(ctx, WithTTL(time.Minute))
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						pool.giveBack(ctx, db)
+
+						cancel()
+					}
+				}
+			}
+
+			done := make(chan error)
+			go func() { done <- pool.Run(ctx) }()
+
+			if !tt.canceled {
+				for pool.Stats().Ready < 2 {
+					time.Sleep(time.Millisecond)
+				}
+				cancel()
+			}
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Run() error = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run() didn't return")
+			}
+
+			if names := database.names(); len(names) != 0 {
+				t.Errorf("DBs = %v after shutdown, want none", names)
+			}
+		})
+	}
+}
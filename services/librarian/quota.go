@@ -0,0 +1,116 @@
+package librarian
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Limits of a quota which are reported by QuotaError.
+const (
+	LimitDatabases = "maxDatabases"
+	LimitTTL       = "maxTTL"
+	LimitDBHours   = "maxDBHours"
+)
+
+// Quota limits DBs of a tenant. Zero values are unlimited.
+type Quota struct {
+	// Active DBs at the same time
+	MaxDatabases int
+	// TTL of a DB, DBs without TTL aren't allowed if it's set
+	MaxTTL time.Duration
+	// Hours left until expiration summed over active DBs, DBs without TTL
+	// aren't allowed if it's set
+	MaxDBHours int
+}
+
+// Usage is the part of a quota which is taken by active DBs of a tenant.
+type Usage struct {
+	Databases int
+	// Time left until expiration summed over active DBs
+	DBTime time.Duration
+}
+
+// Usager returns the usage of quotas by active DBs of the owner.
+type Usager interface {
+	Usage(ctx context.Context, owner string) (Usage, error)
+}
+
+// QuotaError is returned when a tenant exceeds a limit of its quota. It isn't
+// wrapped into a category, so use errors.Cause to get it.
+type QuotaError struct {
+	Tenant string
+	// One of LimitDatabases, LimitTTL, LimitDBHours
+	Limit string
+	// Value of the limit, e.g. "10" or "24h0m0s"
+	Max string
+	// PerDB is true if the DB alone exceeds the limit, e.g. its TTL is too
+	// long, so it won't fit even when other DBs expire
+	PerDB bool
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("librarian: quota %s of tenant %s is exceeded (max %s)", e.Limit, e.Tenant, e.Max)
+}
+
+// CheckTTL checks that a DB with the given TTL is allowed. TTL 0 means the DB
+// never expires.
+func (q *Quota) CheckTTL(tenant string, ttl time.Duration) error {
+	if q.MaxTTL > 0 && (ttl == 0 || ttl > q.MaxTTL) {
+		return &QuotaError{Tenant: tenant, Limit: LimitTTL, Max: q.MaxTTL.String(), PerDB: true}
+	}
+
+	if q.MaxDBHours > 0 && (ttl == 0 || ttl > time.Duration(q.MaxDBHours)*time.Hour) {
+		return &QuotaError{Tenant: tenant, Limit: LimitDBHours, Max: strconv.Itoa(q.MaxDBHours), PerDB: true}
+	}
+
+	return nil
+}
+
+// Check checks that one more DB with the given TTL fits into the quota of the
+// tenant which already has the usage. It must be checked atomically with
+// adding the DB, see Enforcer.
+func (q *Quota) Check(tenant string, usage Usage, ttl time.Duration) error {
+	if err := q.CheckTTL(tenant, ttl); err != nil {
+		return err
+	}
+
+	if q.MaxDatabases > 0 && usage.Databases+1 > q.MaxDatabases {
+		return &QuotaError{Tenant: tenant, Limit: LimitDatabases, Max: strconv.Itoa(q.MaxDatabases)}
+	}
+
+	return q.CheckRenew(tenant, usage, 0, ttl)
+}
+
+// CheckRenew checks that an active DB of the tenant still fits into the quota
+// when the time it has left is replaced with the given TTL. The usage
+// includes the DB.
+func (q *Quota) CheckRenew(tenant string, usage Usage, left, ttl time.Duration) error {
+	if err := q.CheckTTL(tenant, ttl); err != nil {
+		return err
+	}
+
+	if q.MaxDBHours > 0 && usage.DBTime-left+ttl > time.Duration(q.MaxDBHours)*time.Hour {
+		return &QuotaError{Tenant: tenant, Limit: LimitDBHours, Max: strconv.Itoa(q.MaxDBHours)}
+	}
+
+	return nil
+}
+
+// Quotas are quotas of tenants. Tenants without their own quota get the
+// default one.
+type Quotas struct {
+	Default Quota
+	Tenants map[string]Quota
+}
+
+func (q *Quotas) For(tenant string) *Quota {
+	if quota, ok := q.Tenants[tenant]; ok {
+		return &quota
+	}
+
+	quota := q.Default
+
+	return &quota
+}
@@ -0,0 +1,142 @@
+package librarian
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type ReaperOption func(*Reaper)
+
+func WithReaperInterval(interval time.Duration) ReaperOption {
+	return func(o *Reaper) { o.interval = interval }
+}
+
+// WithReaperJitter sets the maximum random delay added to every interval, so
+// several librarian instances don't hit the same backends at the same time.
+func WithReaperJitter(jitter time.Duration) ReaperOption {
+	return func(o *Reaper) { o.jitter = jitter }
+}
+
+// WithReaperShutdownTimeout sets the timeout of the final pass which is run
+// after the context of Run is done.
+func WithReaperShutdownTimeout(timeout time.Duration) ReaperOption {
+	return func(o *Reaper) { o.shutdownTimeout = timeout }
+}
+
+func WithReaperLogger(logger *zap.Logger) ReaperOption {
+	return func(o *Reaper) { o.logger = logger }
+}
+
+// Reaper periodically deletes expired DBs and expired users of alive DBs from
+// every registered database.
+type Reaper struct {
+	librarian *Librarian
+
+	interval        time.Duration
+	jitter          time.Duration
+	shutdownTimeout time.Duration
+	logger          *zap.Logger
+
+	rand *rand.Rand
+}
+
+func NewReaper(librarian *Librarian, opts ...ReaperOption) *Reaper {
+	r := &Reaper{
+		librarian: librarian,
+
+		interval:        time.Minute,
+		jitter:          10 * time.Second,
+		shutdownTimeout: 30 * time.Second,
+		logger:          zap.NewNop(),
+
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())), // nolint:gosec
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Run reaps expired DBs until ctx is done and then runs one final pass.
+func (r *Reaper) Run(ctx context.Context) error {
+	r.Reap(ctx)
+
+	for {
+		timer := time.NewTimer(r.next())
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			r.logger.Info("Run final reaper pass")
+
+			// NOTE: ctx is already done, so we need a new one.
+			fctx, cancel := context.WithTimeout(context.Background(), r.shutdownTimeout)
+			defer cancel()
+
+			r.Reap(fctx)
+
+			return nil
+
+		case <-timer.C:
+			r.Reap(ctx)
+		}
+	}
+}
+
+// Reap calls DeleteExpired and DeleteExpiredUsers on every registered
+// database once. Errors are logged and don't stop the pass; DBs returned along
+// with an error are reported too.
+func (r *Reaper) Reap(ctx context.Context) {
+	for _, name := range r.librarian.Databases() {
+		database := r.librarian.Get(name)
+		if database == nil {
+			continue
+		}
+
+		dbs, err := database.DeleteExpired(ctx)
+		if err != nil {
+			r.logger.Error("Cannot delete expired DBs", zap.String("database", name), zap.Error(err))
+		}
+
+		for _, db := range dbs {
+			r.logger.Info("Expired DB was deleted",
+				zap.String("database", name),
+				zap.String("db", db.Database),
+				zap.String("username", db.Username),
+			)
+		}
+
+		if len(dbs) > 0 {
+			r.logger.Info("Expired DBs were deleted", zap.String("database", name), zap.Int("count", len(dbs)))
+		}
+
+		dbs, err = database.DeleteExpiredUsers(ctx)
+		if err != nil {
+			r.logger.Error("Cannot delete expired users", zap.String("database", name), zap.Error(err))
+		}
+
+		for _, db := range dbs {
+			for _, user := range db.Users {
+				r.logger.Info("Expired user was deleted",
+					zap.String("database", name),
+					zap.String("db", db.Database),
+					zap.String("username", user.Username),
+				)
+			}
+		}
+	}
+}
+
+func (r *Reaper) next() time.Duration {
+	if r.jitter <= 0 {
+		return r.interval
+	}
+
+	return r.interval + time.Duration(r.rand.Int63n(int64(r.jitter)))
+}
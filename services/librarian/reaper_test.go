@@ -0,0 +1,182 @@
+package librarian
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reaperDatabase counts reaper passes. Methods which aren't used by tests
+// panic.
+type reaperDatabase struct {
+	Database
+
+	mu         sync.Mutex
+	passes     int
+	userPasses int
+	// block makes DeleteExpired wait until its context is done
+	block bool
+	// calls receive errors of contexts of DeleteExpired calls
+	calls chan error
+}
+
+func newReaperDatabase() *reaperDatabase {
+	return &reaperDatabase{
+		Database: nil,
+
+		mu:         sync.Mutex{},
+		passes:     0,
+		userPasses: 0,
+		block:      false,
+		calls:      make(chan error, 100),
+	}
+}
+
+func (d *reaperDatabase) DeleteExpired(ctx context.Context) ([]DB, error) {
+	d.mu.Lock()
+	d.passes++
+	block := d.block
+	d.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+	}
+
+	d.calls <- ctx.Err()
+
+	return []DB{{Database: "db_1"}}, errors.New("connection refused")
+}
+
+func (d *reaperDatabase) DeleteExpiredUsers(ctx context.Context) ([]DB, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.userPasses++
+
+	return nil, errors.New("connection refused")
+}
+
+func (d *reaperDatabase) counts() (passes, userPasses int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.passes, d.userPasses
+}
+
+func newTestReaper(t *testing.T, database Database, opts ...ReaperOption) *Reaper {
+	t.Helper()
+
+	l := New()
+	if err := l.Register("postgres", database); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewReaper(l, opts...)
+}
+
+// waitCall returns the context error of the next DeleteExpired call.
+func waitCall(t *testing.T, database *reaperDatabase) error {
+	t.Helper()
+
+	select {
+	case err := <-database.calls:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("DeleteExpired wasn't called")
+		return nil
+	}
+}
+
+func TestReaperRun(t *testing.T) {
+	database := newReaperDatabase()
+	reaper := newTestReaper(t, database, WithReaperInterval(10*time.Millisecond), WithReaperJitter(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() { done <- reaper.Run(ctx) }()
+
+	// Passes go on after errors
+	for i := 0; i < 3; i++ {
+		if err := waitCall(t, database); err != nil {
+			t.Fatalf("pass %d: context error = %v", i, err)
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return")
+	}
+
+	// The final pass has its own context
+	var final error
+	for len(database.calls) > 0 {
+		final = <-database.calls
+	}
+	if final != nil {
+		t.Errorf("final pass: context error = %v, want nil", final)
+	}
+
+	if passes, userPasses := database.counts(); passes < 4 || userPasses != passes {
+		t.Errorf("%d passes and %d user passes, want at least 4 of each", passes, userPasses)
+	}
+}
+
+func TestReaperShutdownTimeout(t *testing.T) {
+	database := newReaperDatabase()
+	reaper := newTestReaper(t, database,
+		WithReaperInterval(time.Hour),
+		WithReaperJitter(0),
+		WithReaperShutdownTimeout(50*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() { done <- reaper.Run(ctx) }()
+
+	waitCall(t, database) // nolint:errcheck
+
+	database.mu.Lock()
+	database.block = true
+	database.mu.Unlock()
+
+	start := time.Now()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return")
+	}
+
+	if err := waitCall(t, database); err != context.DeadlineExceeded {
+		t.Errorf("final pass: context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("final pass took %s, want at least the timeout", elapsed)
+	}
+}
+
+func TestReaperNext(t *testing.T) {
+	reaper := NewReaper(New(), WithReaperInterval(time.Minute), WithReaperJitter(10*time.Second))
+
+	for i := 0; i < 100; i++ {
+		if next := reaper.next(); next < time.Minute || next >= time.Minute+10*time.Second {
+			t.Fatalf("next() = %s, want from 1m0s to 1m10s", next)
+		}
+	}
+
+	reaper = NewReaper(New(), WithReaperInterval(time.Minute), WithReaperJitter(0))
+	if next := reaper.next(); next != time.Minute {
+		t.Errorf("next() without jitter = %s, want 1m0s", next)
+	}
+}